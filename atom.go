@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type AtomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Links    []AtomLink  `xml:"link"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []AtomLink `xml:"link"`
+	Summary   AtomText   `xml:"summary"`
+	Content   AtomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Atom text constructs can hold plain text, escaped html or inline xhtml markup
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// Parses an Atom 1.0 document and maps it onto the RSSFeed structure
+func parseAtom(body []byte) (*RSSFeed, error) {
+	atomFeed := AtomFeed{}
+	err := xml.Unmarshal(body, &atomFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = atomFeed.Title
+	rssFeed.Channel.Link = alternateLink(atomFeed.Links)
+	rssFeed.Channel.Description = atomFeed.Subtitle
+
+	for _, entry := range atomFeed.Entries {
+		// Prefer the short summary, but many feeds only ship the full content
+		description := entry.Summary.value()
+		if description == "" {
+			description = entry.Content.value()
+		}
+
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			GUID:        entry.ID,
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			PubDate:     pubDate,
+		})
+	}
+
+	return &rssFeed, nil
+}
+
+// Returns the text of the construct, keeping the markup of xhtml content
+func (t AtomText) value() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.InnerXML)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// Picks the link pointing at the html version of a feed or entry
+func alternateLink(links []AtomLink) string {
+	fallback := ""
+	for _, link := range links {
+		// A missing rel attribute means "alternate" per the Atom spec
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if fallback == "" {
+			fallback = link.Href
+		}
+	}
+	if fallback == "" && len(links) > 0 {
+		fallback = links[0].Href
+	}
+	return fallback
+}
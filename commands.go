@@ -4,42 +4,86 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/Luis-E-Ortega/gatorcli/internal/config"
 	"github.com/Luis-E-Ortega/gatorcli/internal/database"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 	"github.com/pressly/goose/v3"
 )
 
+// How long agg lets in-flight fetches run after being asked to shut down
+const shutdownTimeout = 15 * time.Second
+
 type state struct {
-	db    *database.Queries
-	cfg   *config.Config
-	RawDB *sql.DB
+	db      *database.Queries
+	cfg     *config.Config
+	RawDB   *sql.DB
+	fetcher *fetcher
+	polling pollingBounds
+	output  outputFormat
 }
 
+// A command as given on the command line. Flags have already been parsed out of
+// the arguments, leaving only the positional ones
 type command struct {
 	name      string
 	arguments []string
+	flags     *flag.FlagSet
+	usage     string
+}
+
+// Describes a command's arguments and flags, so they can be checked before the
+// handler runs and listed by help
+type commandSpec struct {
+	args        string // Positional arguments for the usage line, e.g. "[name] <url>"
+	description string
+	minArgs     int
+	maxArgs     int // -1 allows any number
+	flags       func(*flag.FlagSet)
+	handler     func(*state, command) error
 }
 
 type commands struct {
-	allCommands map[string]func(*state, command) error
+	allCommands map[string]commandSpec
+	names       []string // Registration order, used to list commands in help
 }
 
-// Used to login as a specific user
-func handlerLogin(s *state, cmd command) error {
-	// First check to ensure arguments isn't empty
-	if len(cmd.arguments) < 1 {
-		err := errors.New("username required")
-		return err
+// Returned when a command is called with the wrong arguments or flags
+type usageError struct {
+	command string
+	usage   string
+	err     error
+}
+
+func (e *usageError) Error() string {
+	if e.command == "" {
+		return fmt.Sprintf("%v\nRun 'gator help' to see the available commands", e.err)
 	}
+	return fmt.Sprintf("%v\nUsage: %s\nRun 'gator help %s' for more", e.err, e.usage, e.command)
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// For handlers to report arguments or flag values they can't use, the same way
+// as arguments that don't match the command's spec
+func (cmd command) misuse(err error) error {
+	return &usageError{command: cmd.name, usage: cmd.usage, err: err}
+}
 
+// Used to login as a specific user
+func handlerLogin(s *state, cmd command) error {
 	// Get user and check error to make sure a user exists before allowing login
 	_, err := s.db.GetUser(context.Background(), cmd.arguments[0])
 	if err == sql.ErrNoRows {
@@ -56,24 +100,108 @@ func handlerLogin(s *state, cmd command) error {
 	return nil
 }
 
-// Dispatches the requested CLI command by looking up its handler and executing it
-func (c *commands) run(s *state, cmd command) error {
-	if inputCommand, ok := c.allCommands[cmd.name]; ok {
-		err := inputCommand(s, cmd)
-		if err != nil {
-			fmt.Printf("Error running run method: %v", err)
-			return err
+// Looks up the requested CLI command and checks its flags and number of positional
+// arguments against the spec, so misuse is caught before anything runs. Returns
+// flag.ErrHelp when --help was passed
+func (c *commands) parse(cmd command) (commandSpec, command, error) {
+	spec, ok := c.allCommands[cmd.name]
+	if !ok {
+		return commandSpec{}, cmd, &usageError{err: fmt.Errorf("unknown command: %s", cmd.name)}
+	}
+
+	flags := c.flagSet(cmd.name, spec)
+	args, err := parseFlags(flags, cmd.arguments)
+	if errors.Is(err, flag.ErrHelp) {
+		return spec, cmd, err
+	}
+	if err != nil {
+		return spec, cmd, &usageError{command: cmd.name, usage: usageLine(cmd.name, spec), err: err}
+	}
+	if len(args) < spec.minArgs {
+		return spec, cmd, &usageError{command: cmd.name, usage: usageLine(cmd.name, spec), err: errors.New("not enough arguments")}
+	}
+	if spec.maxArgs >= 0 && len(args) > spec.maxArgs {
+		return spec, cmd, &usageError{command: cmd.name, usage: usageLine(cmd.name, spec), err: errors.New("too many arguments")}
+	}
+
+	return spec, command{name: cmd.name, arguments: args, flags: flags, usage: usageLine(cmd.name, spec)}, nil
+}
+
+// Dispatches a parsed CLI command to its handler
+func (c *commands) run(s *state, spec commandSpec, cmd command) error {
+	return spec.handler(s, cmd)
+}
+
+// Adds a command to the CLI
+func (c *commands) register(name string, spec commandSpec) {
+	c.allCommands[name] = spec
+	c.names = append(c.names, name)
+}
+
+// Builds the command's flag set. Parse errors are reported by run, so the flag
+// package's own messages are silenced
+func (c *commands) flagSet(name string, spec commandSpec) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	if spec.flags != nil {
+		spec.flags(flags)
+	}
+	return flags
+}
+
+func usageLine(name string, spec commandSpec) string {
+	usage := "gator " + name
+	if spec.flags != nil {
+		usage += " [flags]"
+	}
+	if spec.args != "" {
+		usage += " " + spec.args
+	}
+	return usage
+}
+
+// Lists every command, or describes one command with its flags
+func (c *commands) help(s *state, cmd command) error {
+	if len(cmd.arguments) > 0 {
+		spec, ok := c.allCommands[cmd.arguments[0]]
+		if !ok {
+			return &usageError{err: fmt.Errorf("unknown command: %s", cmd.arguments[0])}
 		}
-	} else {
-		fmt.Printf("Unknown command : %s\n", cmd.name)
-		return fmt.Errorf("unkown command: %s", cmd.name)
+		c.printCommandHelp(cmd.arguments[0], spec)
+		return nil
 	}
+
+	fmt.Println("Usage: gator [--output text|json|jsonl|csv|table] <command> [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range c.names {
+		fmt.Fprintf(w, "  %s\t%s\n", name, c.allCommands[name].description)
+	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println("Run 'gator help <command>' or 'gator <command> --help' for details")
 	return nil
 }
 
-// Used to register a new user
-func (c *commands) register(name string, f func(*state, command) error) {
-	c.allCommands[name] = f
+func (c *commands) printCommandHelp(name string, spec commandSpec) {
+	fmt.Printf("Usage: %s\n\n%s\n", usageLine(name, spec), spec.description)
+	if spec.flags == nil {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("Flags:")
+	flags := c.flagSet(name, spec)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	flags.VisitAll(func(f *flag.Flag) {
+		kind, usage := flag.UnquoteUsage(f)
+		if f.DefValue != "" && f.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(w, "  --%s %s\t%s\n", f.Name, kind, usage)
+	})
+	w.Flush()
 }
 
 // Resets the database, running goose migrations down and up
@@ -113,140 +241,505 @@ func (c *commands) users(s *state, cmd command) error {
 		return err
 	}
 
+	type userRecord struct {
+		database.User
+		Current bool
+	}
+	records := []userRecord{}
 	for _, user := range usersList {
-		if user == s.cfg.CurrentUserName {
-			fmt.Printf("*%s (current)\n", user)
-		} else {
-			fmt.Println("*" + user)
-		}
+		records = append(records, userRecord{User: user, Current: user.Name == s.cfg.CurrentUserName})
 	}
-	return nil
+
+	return s.render(records, func() {
+		for _, user := range records {
+			if user.Current {
+				fmt.Printf("*%s (current)\n", user.Name)
+			} else {
+				fmt.Println("*" + user.Name)
+			}
+		}
+	})
+}
+
+func aggFlags(flags *flag.FlagSet) {
+	flags.Int("workers", 1, "number of feeds to fetch in parallel each tick")
+	flags.Bool("once", false, "fetch every due feed once and exit")
 }
 
 // Continuously running program to check for (and apply) updates to feeds at a given interval
 func (c *commands) agg(s *state, cmd command) error {
-	if len(cmd.arguments) < 1 {
-		return errors.New("missing time_between_reqs argument")
+	workers := cmd.intFlag("workers")
+	once := cmd.boolFlag("once")
+	if workers < 1 {
+		return cmd.misuse(errors.New("--workers must be at least 1"))
 	}
-	time_between_reqs, err := time.ParseDuration(cmd.arguments[0])
-	if err != nil {
-		return err
+
+	var time_between_reqs time.Duration
+	var err error
+	if once && len(cmd.arguments) > 0 {
+		return cmd.misuse(errors.New("--once fetches a single time and doesn't take an interval"))
+	}
+	if !once {
+		if len(cmd.arguments) < 1 {
+			return cmd.misuse(errors.New("missing time_between_reqs argument"))
+		}
+		time_between_reqs, err = time.ParseDuration(cmd.arguments[0])
+		if err != nil || time_between_reqs <= 0 {
+			return cmd.misuse(fmt.Errorf("invalid interval '%s', use a duration such as 1m", cmd.arguments[0]))
+		}
 	}
 
-	fmt.Printf("Collecting feeds every %v\n", time_between_reqs)
+	// Stop collecting on Ctrl-C or a SIGTERM from a service manager
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Fetches get their own context so the ones in flight can finish after a
+	// shutdown is requested, but only for up to shutdownTimeout
+	fetchCtx, cancelFetches := context.WithCancel(context.Background())
+	defer cancelFetches()
+	go func() {
+		<-ctx.Done()
+		// Restore the default signal handling so a second Ctrl-C exits immediately
+		stop()
+		select {
+		case <-time.After(shutdownTimeout):
+			cancelFetches()
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	if once {
+		return c.aggOnce(fetchCtx, s, workers)
+	}
+
+	fmt.Printf("Collecting feeds every %v using %d workers\n", time_between_reqs, workers)
 	ticker := time.NewTicker(time_between_reqs)
 	defer ticker.Stop()
 
 	for {
 		// Call scrapeFeeds function
-		err := c.scrapeFeeds(s)
+		err := c.scrapeFeeds(fetchCtx, s, workers)
 		if err != nil {
 			fmt.Println("Error scraping feeds:", err)
 		}
 
-		<-ticker.C // wait for next tick
+		// Wait for next tick, or stop once the current batch is done if asked to
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down aggregator")
+			return nil
+		case <-ticker.C:
+		}
 	}
 }
 
-// Used by agg to fetch feeds and keep database updated while running
-func (c *commands) scrapeFeeds(s *state) error {
-	nextFeed, err := s.db.GetNextFeedToFetch(context.Background())
+func browseFlags(flags *flag.FlagSet) {
+	flags.Int("limit", 2, "maximum number of posts to show")
+	flags.Int("offset", 0, "number of posts to skip")
+	flags.String("after", "", "continue from the cursor printed after the previous page")
+	flags.String("feed", "", "only show posts from this feed url or name")
+	flags.String("since", "", "only show posts published since this date, or within this long ago (e.g. 72h)")
+	flags.String("until", "", "only show posts published before this date, or before this long ago")
+	flags.String("sort", "newest", "newest or oldest first")
+	flags.Bool("unread", true, "only show posts that haven't been marked read")
+	flags.Bool("starred", false, "only show starred posts")
+}
+
+// Displays info on followed posts, optional limit for how many to display at once.
+// Pages continue from the cursor printed after a full page, or skip ahead with --offset
+func (c *commands) browse(s *state, cmd command) error {
+	limit := cmd.intFlag("limit")
+	offset := cmd.intFlag("offset")
+	after := cmd.stringFlag("after")
+	feedArg := cmd.stringFlag("feed")
+	sinceArg := cmd.stringFlag("since")
+	untilArg := cmd.stringFlag("until")
+	sortOrder := cmd.stringFlag("sort")
+	unread := cmd.boolFlag("unread")
+	starred := cmd.boolFlag("starred")
+
+	// The limit can still be given positionally
+	if len(cmd.arguments) > 0 {
+		parsed, err := strconv.Atoi(cmd.arguments[0])
+		if err != nil || parsed <= 0 {
+			return cmd.misuse(fmt.Errorf("invalid limit '%s', use a positive number", cmd.arguments[0]))
+		}
+		limit = parsed
+	}
+	if limit <= 0 || offset < 0 {
+		return cmd.misuse(errors.New("--limit must be positive and --offset can't be negative"))
+	}
+	if sortOrder != "newest" && sortOrder != "oldest" {
+		return cmd.misuse(fmt.Errorf("unknown sort order '%s', use newest or oldest", sortOrder))
+	}
+	// Starred posts have usually been read, so only hide read ones when asked to
+	if starred && !cmd.flagGiven("unread") {
+		unread = false
+	}
+
+	currentUser := s.cfg.CurrentUserName
+	if currentUser == "" {
+		return errors.New("must be logged in to browse posts")
+	}
+	user, err := s.db.GetUser(context.Background(), currentUser)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now()
-	err = s.db.MarkFeedFetched(
-		context.Background(),
-		database.MarkFeedFetchedParams{
-			LastFetchedAt: sql.NullTime{Time: now, Valid: true},
-			UpdatedAt:     now,
-			ID:            nextFeed.ID,
-		},
-	)
+	params := database.BrowsePostsForUserParams{
+		UserID:       user.ID,
+		UnreadOnly:   unread,
+		StarredOnly:  starred,
+		OldestFirst:  sortOrder == "oldest",
+		ResultLimit:  int32(limit),
+		ResultOffset: int32(offset),
+	}
+	if feedArg != "" {
+		feed, err := findFeed(s, feedArg)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	if sinceArg != "" {
+		since, err := parseTimeFilter(sinceArg)
+		if err != nil {
+			return cmd.misuse(fmt.Errorf("invalid --since value: %w", err))
+		}
+		params.Since = sql.NullTime{Time: since, Valid: true}
+	}
+	if untilArg != "" {
+		until, err := parseTimeFilter(untilArg)
+		if err != nil {
+			return cmd.misuse(fmt.Errorf("invalid --until value: %w", err))
+		}
+		params.Until = sql.NullTime{Time: until, Valid: true}
+	}
+	if after != "" {
+		publishedAt, id, err := parseBrowseCursor(after)
+		if err != nil {
+			return cmd.misuse(err)
+		}
+		params.AfterPublishedAt = sql.NullTime{Time: publishedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	postsList, err := s.db.BrowsePostsForUser(context.Background(), params)
+	if err != nil {
+		return err
+	}
+	if postsList == nil {
+		postsList = []database.BrowsePostsForUserRow{}
+	}
+	return s.render(postsList, func() {
+		for _, post := range postsList {
+			fmt.Printf("ID: %s\nTitle: %s\nURL: %s\nPublished: %s\n\n", post.ID, post.Title, post.Url, post.PublishedAt.Format(time.RFC1123))
+		}
+		if len(postsList) == limit {
+			last := postsList[len(postsList)-1]
+			fmt.Printf("More posts: --after %s\n", browseCursor(last))
+		}
+	})
+}
+
+// Cursors mark the last post of a page by its publish date and ID, so the next
+// page starts right after it even when new posts arrive in between
+func browseCursor(post database.BrowsePostsForUserRow) string {
+	return post.PublishedAt.UTC().Format(time.RFC3339Nano) + "," + post.ID.String()
+}
+
+func parseBrowseCursor(cursor string) (time.Time, uuid.UUID, error) {
+	date, id, found := strings.Cut(cursor, ",")
+	if !found {
+		return time.Time{}, uuid.UUID{}, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	publishedAt, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	postID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	return publishedAt.UTC(), postID, nil
+}
+
+// Accepts either a date or a duration meaning that long ago, returned in UTC
+// to match how publish dates are stored
+func parseTimeFilter(value string) (time.Time, error) {
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().UTC().Add(-ago), nil
+	}
+	return parsePublishDate(value)
+}
+
+// Looks up a post by the ID browse prints for it, or by its URL
+func findPost(s *state, user database.User, idOrURL string) (database.GetPostRow, error) {
+	if id, err := uuid.Parse(idOrURL); err == nil {
+		post, err := s.db.GetPost(context.Background(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.GetPostRow{}, fmt.Errorf("no post found with id '%s'", idOrURL)
+		}
+		return post, err
+	}
+
+	// Several feeds can share a post URL, so only look in the ones the user follows
+	posts, err := s.db.GetPostsByURLForUser(context.Background(), database.GetPostsByURLForUserParams{
+		UserID: user.ID,
+		Url:    idOrURL,
+	})
+	if err != nil {
+		return database.GetPostRow{}, err
+	}
+	switch len(posts) {
+	case 0:
+		return database.GetPostRow{}, fmt.Errorf("no post found in your feeds with url '%s'", idOrURL)
+	case 1:
+		return database.GetPostRow(posts[0]), nil
+	default:
+		return database.GetPostRow{}, fmt.Errorf("%d posts in your feeds have the url '%s', use the post ID instead", len(posts), idOrURL)
+	}
+}
+
+// Marks a single post as read so browse stops showing it
+func (c *commands) read(s *state, cmd command, user database.User) error {
+	post, err := findPost(s, user, cmd.arguments[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: time.Now(),
+	})
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Marked '%s' as read\n", post.Title)
+	return nil
+}
 
-	parsedFeed, err := fetchFeed(context.Background(), nextFeed.Url)
+// Marks a post as unread again so browse shows it
+func (c *commands) unread(s *state, cmd command, user database.User) error {
+	post, err := findPost(s, user, cmd.arguments[0])
 	if err != nil {
 		return err
 	}
 
-	for _, item := range parsedFeed.Channel.Item {
-		pubDateStr := item.PubDate
-		layout := time.RFC1123
+	_, err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Marked '%s' as unread\n", post.Title)
+	return nil
+}
 
-		// Format publish date to match the variable type in params
-		publishedAt, err := time.Parse(layout, pubDateStr)
+func markreadFlags(flags *flag.FlagSet) {
+	flags.String("feed", "", "only mark posts from this feed url or name")
+	flags.String("before", "", "only mark posts published before this date")
+}
+
+// Marks every post published before a date as read, across all followed feeds
+// or just one of them. Without --before, everything up to now is marked read
+func (c *commands) markread(s *state, cmd command, user database.User) error {
+	feedArg := cmd.stringFlag("feed")
+	beforeArg := cmd.stringFlag("before")
+
+	now := time.Now()
+	before := now.UTC()
+	var err error
+	if beforeArg != "" {
+		before, err = parsePublishDate(beforeArg)
 		if err != nil {
-			return err
+			return cmd.misuse(fmt.Errorf("invalid --before date: %w", err))
 		}
-		// Format description to match the variable type in params
-		desc := sql.NullString{
-			String: item.Description,
-			Valid:  item.Description != "",
-		}
-		_, err = s.db.CreatePost(
-			context.Background(),
-			database.CreatePostParams{
-				ID:          uuid.New(),
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-				Title:       item.Title,
-				Url:         item.Link,
-				Description: desc,
-				PublishedAt: publishedAt,
-				FeedID:      nextFeed.ID,
-			})
+	}
+
+	feedID := uuid.NullUUID{}
+	if feedArg != "" {
+		feed, err := findFeed(s, feedArg)
 		if err != nil {
-			// This error comes from the pq package(Postgres driver)
-			if pgErr, ok := err.(*pq.Error); ok {
-				if pgErr.Code == "23505" { // unique_violation error code
-					// Means there was a duplicate URL, simply skip
-					continue
-				}
-			}
-			// For other errors, return or handle
-			log.Printf("failed to create post: %v", err)
 			return err
 		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
 	}
 
+	marked, err := s.db.MarkPostsRead(context.Background(), database.MarkPostsReadParams{
+		ReadAt: now,
+		UserID: user.ID,
+		Before: before,
+		FeedID: feedID,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Marked %d posts as read\n", marked)
 	return nil
 }
 
-// Displays info on followed posts, optional limit for how many to display at once
-func (c *commands) browse(s *state, cmd command) error {
-	limit := 2 // Set default limit
-	if len(cmd.arguments) > 0 {
-		if parsed, err := strconv.Atoi(cmd.arguments[0]); err == nil && parsed > 0 {
-			limit = parsed
+func searchFlags(flags *flag.FlagSet) {
+	flags.String("feed", "", "only search posts from this feed url or name")
+	flags.String("since", "", "only search posts published since this date, or within this long ago (e.g. 720h)")
+	flags.Int("limit", 10, "maximum number of results")
+}
+
+// Searches the titles and descriptions of posts in followed feeds, best matches
+// first. The query uses web search syntax: "quoted phrases", -excluded words and or
+func (c *commands) search(s *state, cmd command, user database.User) error {
+	feedArg := cmd.stringFlag("feed")
+	sinceArg := cmd.stringFlag("since")
+	limit := cmd.intFlag("limit")
+	if limit < 1 {
+		return cmd.misuse(errors.New("--limit must be at least 1"))
+	}
+	query := strings.TrimSpace(strings.Join(cmd.arguments, " "))
+	if query == "" {
+		return cmd.misuse(errors.New("search query required"))
+	}
+
+	since := sql.NullTime{}
+	if sinceArg != "" {
+		date, err := parseTimeFilter(sinceArg)
+		if err != nil {
+			return cmd.misuse(fmt.Errorf("invalid --since value: %w", err))
 		}
+		since = sql.NullTime{Time: date, Valid: true}
 	}
-	currentUser := s.cfg.CurrentUserName
-	if currentUser == "" {
-		return errors.New("must be logged in to browse posts")
+
+	feedID := uuid.NullUUID{}
+	if feedArg != "" {
+		feed, err := findFeed(s, feedArg)
+		if err != nil {
+			return err
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
 	}
-	user, err := s.db.GetUser(context.Background(), currentUser)
+
+	results, err := s.db.SearchPostsForUser(context.Background(), database.SearchPostsForUserParams{
+		Query:       query,
+		UserID:      user.ID,
+		FeedID:      feedID,
+		Since:       since,
+		ResultLimit: int32(limit),
+	})
 	if err != nil {
 		return err
 	}
-	postsList, err := s.db.GetPostsForUser(
-		context.Background(),
-		database.GetPostsForUserParams{
-			UserID: user.ID,
-			Limit:  int32(limit),
-		})
+	if results == nil {
+		results = []database.SearchPostsForUserRow{}
+	}
+	return s.render(results, func() {
+		if len(results) == 0 {
+			fmt.Println("No posts found")
+		}
+		for _, post := range results {
+			fmt.Printf("ID: %s\nTitle: %s\nFeed: %s\nURL: %s\nPublished: %s\n\n", post.ID, post.Title, post.FeedName, post.Url, post.PublishedAt.Format(time.RFC1123))
+		}
+	})
+}
+
+// Stars a post so it can be found again with starred
+func (c *commands) star(s *state, cmd command, user database.User) error {
+	post, err := findPost(s, user, cmd.arguments[0])
 	if err != nil {
 		return err
 	}
-	for _, post := range postsList {
-		fmt.Printf("Title: %s\nURL: %s\nPublished: %s\n\n", post.Title, post.Url, post.PublishedAt.Format(time.RFC1123))
+
+	err = s.db.StarPost(context.Background(), database.StarPostParams{
+		UserID:    user.ID,
+		PostID:    post.ID,
+		StarredAt: time.Now(),
+	})
+	if err != nil {
+		return err
 	}
+	fmt.Printf("Starred '%s'\n", post.Title)
 	return nil
 }
 
+func (c *commands) unstar(s *state, cmd command, user database.User) error {
+	post, err := findPost(s, user, cmd.arguments[0])
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.db.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("'%s' isn't starred", post.Title)
+	}
+	fmt.Printf("Unstarred '%s'\n", post.Title)
+	return nil
+}
+
+// Lists starred posts, most recently starred first, including posts from
+// feeds the user no longer follows
+func (c *commands) starred(s *state, cmd command, user database.User) error {
+	limit := 10
+	if len(cmd.arguments) > 0 {
+		parsed, err := strconv.Atoi(cmd.arguments[0])
+		if err != nil || parsed <= 0 {
+			return cmd.misuse(fmt.Errorf("invalid limit '%s', use a positive number", cmd.arguments[0]))
+		}
+		limit = parsed
+	}
+
+	postsList, err := s.db.GetStarredPostsForUser(context.Background(), database.GetStarredPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return err
+	}
+	if postsList == nil {
+		postsList = []database.GetStarredPostsForUserRow{}
+	}
+	return s.render(postsList, func() {
+		for _, post := range postsList {
+			fmt.Printf("ID: %s\nTitle: %s\nURL: %s\nPublished: %s\n\n", post.ID, post.Title, post.Url, post.PublishedAt.Format(time.RFC1123))
+		}
+	})
+}
+
+// Lists feeds whose recent fetches failed, along with why and when they'll be retried
+func (c *commands) feedstatus(s *state, cmd command) error {
+	feeds, err := s.db.GetFailingFeeds(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if feeds == nil {
+		feeds = []database.Feed{}
+	}
+
+	return s.render(feeds, func() {
+		if len(feeds) == 0 {
+			fmt.Println("All feeds are fetching successfully")
+		}
+		for _, feed := range feeds {
+			status := "none"
+			if feed.LastHttpStatus.Valid {
+				status = strconv.Itoa(int(feed.LastHttpStatus.Int32))
+			}
+			nextFetch := "now"
+			if feed.NextFetchAt.Valid {
+				nextFetch = feed.NextFetchAt.Time.Format(time.RFC1123)
+			}
+			fmt.Printf("Feed: %s\n URL: %s\n Failures in a row: %d\n HTTP status: %s\n Last error: %s\n Next attempt: %s\n\n",
+				feed.Name, feed.Url, feed.ConsecutiveFailures, status, feed.LastError.String, nextFetch)
+		}
+	})
+}
+
 // Shows all of the feeds information across users
 func (c *commands) feeds(s *state, cmd command) error {
 	feeds, err := s.db.GetFeeds(context.Background())
@@ -255,79 +748,249 @@ func (c *commands) feeds(s *state, cmd command) error {
 		return err
 	}
 
-	if len(feeds) != 0 {
+	if feeds == nil {
+		feeds = []database.GetFeedsRow{}
+	}
+
+	return s.render(feeds, func() {
 		for _, row := range feeds {
 			fmt.Printf("Feed Information: \n Name: %v\n URL: %v\n Username: %v\n", row.Name, row.Url, row.Username)
 		}
+	})
+}
+
+// Fetches every due feed once and prints a summary, for running agg from cron or CI.
+// Fails if any feed couldn't be fetched so the caller notices
+func (c *commands) aggOnce(ctx context.Context, s *state, workers int) error {
+	// Claim a batch per round rather than every due feed up front, so no claimed
+	// feed waits in the queue for longer than its lease. Fetched feeds are
+	// scheduled into the future, which is what ends the loop
+	outcomes := []scrapeOutcome{}
+	for ctx.Err() == nil {
+		batch, err := c.scrapeDueFeeds(ctx, s, workers)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		outcomes = append(outcomes, batch...)
+	}
+
+	total := scrapeStats{}
+	failed := 0
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			failed++
+			fmt.Printf("FAILED %s (%s): %v\n", outcome.Feed.Name, outcome.Feed.Url, outcome.Err)
+			continue
+		}
+		total.New += outcome.Stats.New
+		total.Updated += outcome.Stats.Updated
+		fmt.Printf("ok     %s (%s): %d new, %d updated, %d unchanged\n",
+			outcome.Feed.Name, outcome.Feed.Url, outcome.Stats.New, outcome.Stats.Updated, outcome.Stats.Skipped)
+	}
+
+	fmt.Printf("Fetched %d feeds: %d new posts, %d updated, %d failed\n", len(outcomes), total.New, total.Updated, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed to fetch", failed, len(outcomes))
 	}
 	return nil
 }
 
-// Used to add a feed to our program that users can then follow after
-// (automatically follows the feed  on command run for the current logged in user)
-func (c *commands) handlerAddfeed(s *state, cmd command, user database.User) error {
-	// First check to ensure arguments isn't empty
-	if len(cmd.arguments) < 2 {
-		err := errors.New("name and url required")
+// Fetches a single feed right away instead of waiting for agg to get to it
+func (c *commands) refresh(s *state, cmd command) error {
+	feed, err := findFeed(s, cmd.arguments[0])
+	if err != nil {
 		return err
 	}
 
-	// Get user input to fill out name and url for the feed
-	userInput := cmd.arguments
-	feedName := userInput[0]
-	feedUrl := userInput[1]
+	now := time.Now()
+	err = s.db.MarkFeedFetched(
+		context.Background(),
+		database.MarkFeedFetchedParams{
+			LastFetchedAt: sql.NullTime{Time: now, Valid: true},
+			UpdatedAt:     now,
+			ID:            feed.ID,
+		},
+	)
+	if err != nil {
+		return err
+	}
 
-	feed, err := s.db.GetFeedByURL(context.Background(), feedUrl)
+	// Same path agg uses, so failures and scheduling are recorded the same way
+	stats, err := c.scrapeFeed(context.Background(), s, feed, now)
 	if err != nil {
-		// Check if the error is specifically 'sql.ErrNoRows'
-		if errors.Is(err, sql.ErrNoRows) {
-			// Case 1: Feed does NOT exist
-			// Proceed to create new feed
-			fmt.Println("Feed not found. Creating new feed...")
-
-			feedParams := database.CreateFeedParams{
-				ID:        uuid.New(),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-				Name:      feedName,
-				Url:       feedUrl,
-				UserID:    user.ID,
-			}
+		return fmt.Errorf("failed to refresh feed '%s': %w", feed.Name, err)
+	}
 
-			newFeed, createErr := s.db.CreateFeed(context.Background(), feedParams)
-			if createErr != nil {
-				return fmt.Errorf("failed to create new feed: %w", createErr)
-			}
-			feed = newFeed // Update 'feed' to hold the newly created feed
-		} else {
-			// Case 2: Some other error occurred while trying to get the new feed
+	fmt.Printf("Refreshed '%s': %d new, %d updated, %d skipped\n", feed.Name, stats.New, stats.Updated, stats.Skipped)
+	return nil
+}
+
+// Looks up a feed by its URL, or by its name when no feed has that URL
+func findFeed(s *state, urlOrName string) (database.Feed, error) {
+	feed, err := s.db.GetFeedByURL(context.Background(), urlOrName)
+	if err == nil {
+		return feed, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, err
+	}
+
+	feeds, err := s.db.GetFeedsByName(context.Background(), urlOrName)
+	if err != nil {
+		return database.Feed{}, err
+	}
+	switch len(feeds) {
+	case 0:
+		return database.Feed{}, fmt.Errorf("no feed found with url or name '%s'", urlOrName)
+	case 1:
+		return feeds[0], nil
+	default:
+		return database.Feed{}, fmt.Errorf("%d feeds are named '%s', use the feed url instead", len(feeds), urlOrName)
+	}
+}
+
+// Used to add a feed to our program that users can then follow after
+// (automatically follows the feed  on command run for the current logged in user).
+// The feed is fetched first, so only URLs that serve a readable feed get added
+func (c *commands) handlerAddfeed(s *state, cmd command, user database.User) error {
+	// Get user input to fill out name and url for the feed, the name being optional
+	userInput := cmd.arguments
+	feedName := ""
+	feedUrl := userInput[0]
+	if len(userInput) >= 2 {
+		feedName = userInput[0]
+		feedUrl = userInput[1]
+	}
+
+	_, err := s.db.GetFeedByURL(context.Background(), feedUrl)
+	if err == nil {
+		// Feed already exists, so all that's left is following it
+		fmt.Println("Feed found. Proceeding to follow.")
+		return c.follow(s, command{arguments: []string{feedUrl}}, user)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error checking for existing feed : %w", err)
+	}
+
+	// Fetch the feed before storing anything so typos are caught, and web
+	// pages are swapped for the feed they link to
+	fmt.Println("Feed not found. Fetching it...")
+	resolvedUrl, result, err := s.fetcher.resolveFeed(context.Background(), feedUrl)
+	if err != nil {
+		return fmt.Errorf("could not add '%s': %w", feedUrl, err)
+	}
+	if resolvedUrl != feedUrl {
+		feedUrl = resolvedUrl
+		// The page's feed may have been added already under its own URL
+		_, err = s.db.GetFeedByURL(context.Background(), feedUrl)
+		if err == nil {
+			fmt.Println("Feed found. Proceeding to follow.")
+			return c.follow(s, command{arguments: []string{feedUrl}}, user)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
 			return fmt.Errorf("error checking for existing feed : %w", err)
 		}
 	}
-	// Case 3: Feed WAS found (err is nil here)
-	// Proceed to create the feed follow record using 'feed.ID'
-
-	fmt.Printf("Feed '%s' found/created. Proceeding to follow.\n", feed.Name)
 
-	// Creating a "fake" command to have the proper format to call follow from here
-	fakeCmd := command{
-		arguments: []string{feedUrl},
+	// Default the name to the feed's own title
+	if feedName == "" {
+		feedName = strings.TrimSpace(result.Feed.Channel.Title)
+		if feedName == "" {
+			return errors.New("feed has no title, a name is required")
+		}
 	}
 
-	err = c.follow(s, fakeCmd, user)
+	newFeed, stats, err := c.createFeed(s, user, feedName, feedUrl, result)
 	if err != nil {
 		return err
 	}
 
+	fmt.Printf("Feed '%s' created with %d posts. Now following it.\n", newFeed.Name, stats.New)
 	return nil
 }
 
+// Creates a feed along with its initial posts and follows it for the user,
+// all in one transaction so a failure leaves nothing half added
+func (c *commands) createFeed(s *state, user database.User, name, url string, result *fetchResult) (database.Feed, scrapeStats, error) {
+	ctx := context.Background()
+
+	tx, err := s.RawDB.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	now := time.Now()
+	feed, err := qtx.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		Url:       url,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, fmt.Errorf("failed to create new feed: %w", err)
+	}
+
+	err = qtx.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		LastFetchedAt: sql.NullTime{Time: now, Valid: true},
+		UpdatedAt:     now,
+		ID:            feed.ID,
+	})
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, err
+	}
+
+	feed, stats, err := storeFetchResult(ctx, qtx, tx, feed, result, now)
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, fmt.Errorf("failed to store posts: %w", err)
+	}
+
+	err = c.recordFetchSuccess(ctx, s, qtx, feed, now, result)
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, err
+	}
+
+	_, err = qtx.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, fmt.Errorf("failed to follow new feed: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.Feed{}, scrapeStats{}, err
+	}
+	return feed, stats, nil
+}
+
 // Follows a feed specifically for the logged in user
 func (c *commands) follow(s *state, cmd command, user database.User) error {
 	// Get user input for url
 	url := cmd.arguments[0]
 
 	feed, err := s.db.GetFeedByURL(context.Background(), url)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The URL may be a web page, so look for the feed it links to
+		feedUrl, _, resolveErr := s.fetcher.resolveFeed(context.Background(), url)
+		if resolveErr != nil {
+			return fmt.Errorf("feed '%s' not found: %w", url, resolveErr)
+		}
+		feed, err = s.db.GetFeedByURL(context.Background(), feedUrl)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("feed '%s' hasn't been added yet, use addfeed to add it", feedUrl)
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -357,9 +1020,6 @@ func (c *commands) follow(s *state, cmd command, user database.User) error {
 
 // Used to unfollow a feed
 func (c *commands) unfollow(s *state, cmd command, user database.User) error {
-	if len(cmd.arguments) < 1 {
-		return errors.New("not enough arguments passed into command")
-	}
 	feedURL := cmd.arguments[0]
 	err := s.db.DeleteFeedFollow(
 		context.Background(),
@@ -382,11 +1042,35 @@ func (c *commands) following(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return err
 	}
+
+	type followRecord struct {
+		database.FeedFollow
+		FeedName    string
+		Url         string
+		UnreadCount int64
+	}
+	records := []followRecord{}
 	for _, feed := range feeds {
-		fmt.Println(feed.FeedName)
+		records = append(records, followRecord{
+			FeedFollow: database.FeedFollow{
+				ID:        feed.ID,
+				CreatedAt: feed.CreatedAt,
+				UpdatedAt: feed.UpdatedAt,
+				UserID:    feed.UserID,
+				FeedID:    feed.FeedID,
+				Category:  feed.Category,
+			},
+			FeedName:    feed.FeedName,
+			Url:         feed.Url,
+			UnreadCount: feed.UnreadCount,
+		})
 	}
 
-	return nil
+	return s.render(records, func() {
+		for _, feed := range records {
+			fmt.Printf("%s (%d unread)\n", feed.FeedName, feed.UnreadCount)
+		}
+	})
 }
 
 // Wrapper function used to authenticate login information
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Layouts tried in order when parsing a post's publish date. Weekday names are
+// stripped before parsing (feeds get them wrong or leave off the comma), so
+// none of the RFC 822 style layouts include one
+var publishDateLayouts = []string{
+	// RFC 822/1123 and the usual deviations: single digit days, two-digit
+	// years, missing seconds, spelled out months and zone names
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+
+	// RFC 3339 and other ISO 8601 variants
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+
+	// ANSI C and Unix date output, where the weekday is followed by the month
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+}
+
+// Zone names allowed by RFC 822, plus others common in feeds. Go only knows their
+// offsets when they happen to match the local zone, so they are swapped for
+// numeric offsets up front
+var namedZoneOffsets = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"WET":  "+0000",
+	"WEST": "+0100",
+	"BST":  "+0100",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"IST":  "+0530", // India, by far the most common meaning in feeds
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+// Parses the publish date of a feed item, accepting the many formats found in the wild.
+// The result is always in UTC so posts from different feeds sort correctly
+func parsePublishDate(value string) (time.Time, error) {
+	normalized := normalizePublishDate(value)
+	if normalized == "" {
+		return time.Time{}, errors.New("missing publish date")
+	}
+
+	for _, layout := range publishDateLayouts {
+		publishedAt, err := time.Parse(layout, normalized)
+		if err != nil {
+			continue
+		}
+		// time.Parse gives zone names it doesn't know an offset of zero, which would
+		// silently shift the date, so those are treated as unparseable instead
+		if zone, offset := publishedAt.Zone(); strings.Contains(layout, "MST") && offset == 0 && zone != "UTC" {
+			return time.Time{}, fmt.Errorf("unknown time zone %q in publish date %q", zone, value)
+		}
+		return publishedAt.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized publish date format: %q", value)
+}
+
+// Cleans up a raw date string so it can be matched against publishDateLayouts
+func normalizePublishDate(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	// Drop a leading weekday name ("Mon,", "Monday", "Mon") when a day number follows
+	if len(fields) > 1 && isAlpha(strings.TrimSuffix(fields[0], ",")) && unicode.IsDigit(rune(fields[1][0])) {
+		fields = fields[1:]
+	}
+
+	// Swap zone names for numeric offsets. The zone is usually last, but comes
+	// before the year in ANSI C style dates
+	for i := 1; i < len(fields); i++ {
+		if offset, ok := namedZoneOffsets[strings.ToUpper(fields[i])]; ok {
+			fields[i] = offset
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePublishDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "RFC1123Z", value: "Mon, 02 Jan 2006 15:04:05 -0700", want: time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{name: "zero offset", value: "Mon, 02 Jan 2006 15:04:05 +0000", want: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "named zone", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "two-digit year", value: "Mon, 02 Jan 06 15:04:05 -0700", want: time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{name: "missing weekday", value: "2 Jan 2006 15:04:05 +0100", want: time.Date(2006, 1, 2, 14, 4, 5, 0, time.UTC)},
+		{name: "weekday without comma", value: "Mon 02 Jan 2006 15:04:05 EST", want: time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{name: "wrong weekday", value: "Fri, 02 Jan 2006 15:04 CEST", want: time.Date(2006, 1, 2, 13, 4, 0, 0, time.UTC)},
+		{name: "RFC3339", value: "2006-01-02T15:04:05Z", want: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "RFC3339 with fractional seconds", value: "2006-01-02T15:04:05.123+02:00", want: time.Date(2006, 1, 2, 13, 4, 5, 123000000, time.UTC)},
+		{name: "date only", value: "2006-01-02", want: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "ANSI C", value: "Mon Jan  2 15:04:05 2006", want: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "ANSI C with zone", value: "Mon Jan 2 15:04:05 PST 2006", want: time.Date(2006, 1, 2, 23, 4, 5, 0, time.UTC)},
+		{name: "surrounding whitespace", value: "  Mon, 02 Jan 2006 15:04:05 +0000\n", want: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{name: "unknown zone", value: "Mon, 02 Jan 2006 15:04:05 XYZ", wantErr: true},
+		{name: "unknown format", value: "sometime last week", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+		{name: "only whitespace", value: "   ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parsePublishDate(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tc.want) || got.Location() != time.UTC {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Luis-E-Ortega/gatorcli/internal/database"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Link types web pages use to advertise their feeds
+var feedLinkTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/json",
+}
+
+// Where sites commonly serve their feed when the page doesn't link to it
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml", "/rss"}
+
+// A feed found through autodiscovery
+type feedCandidate struct {
+	Title string
+	URL   string
+}
+
+// Returned when a web page links to more than one feed and the user has to pick
+type multipleFeedsError struct {
+	PageURL    string
+	Candidates []feedCandidate
+}
+
+func (e *multipleFeedsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s links to %d feeds, run the command again with one of these:", e.PageURL, len(e.Candidates))
+	for _, candidate := range e.Candidates {
+		if candidate.Title != "" {
+			fmt.Fprintf(&b, "\n  %s (%s)", candidate.URL, candidate.Title)
+		} else {
+			fmt.Fprintf(&b, "\n  %s", candidate.URL)
+		}
+	}
+	return b.String()
+}
+
+// Works out which feed a URL refers to: the URL itself when it serves a feed, or
+// otherwise the single feed the web page at that URL leads to.
+// Returns the feed's URL along with the fetched feed
+func (f *fetcher) resolveFeed(ctx context.Context, rawURL string) (string, *fetchResult, error) {
+	result, err := f.fetchFeed(ctx, database.Feed{Url: rawURL})
+	if err == nil {
+		return rawURL, result, nil
+	}
+
+	// Only web pages are worth searching, other failures are final
+	var page *notAFeedError
+	if !errors.As(err, &page) {
+		return "", nil, err
+	}
+
+	candidates := f.discoverFeeds(ctx, page)
+	switch len(candidates) {
+	case 0:
+		return "", nil, fmt.Errorf("no feed found at %s: %w", rawURL, err)
+	case 1:
+		fmt.Printf("Found feed at %s\n", candidates[0].URL)
+		result, err := f.fetchFeed(ctx, database.Feed{Url: candidates[0].URL})
+		if err != nil {
+			return "", nil, err
+		}
+		return candidates[0].URL, result, nil
+	default:
+		return "", nil, &multipleFeedsError{PageURL: rawURL, Candidates: candidates}
+	}
+}
+
+// Finds the feeds a web page advertises with <link rel="alternate"> tags,
+// falling back to the first common feed path on the same site that serves a feed
+func (f *fetcher) discoverFeeds(ctx context.Context, page *notAFeedError) []feedCandidate {
+	candidates := feedLinks(page.Body, page.URL)
+	if len(candidates) > 0 {
+		return candidates
+	}
+
+	for _, path := range commonFeedPaths {
+		feedURL := page.URL.ResolveReference(&url.URL{Path: path}).String()
+		result, err := f.fetchFeed(ctx, database.Feed{Url: feedURL})
+		if err == nil {
+			return []feedCandidate{{Title: result.Feed.Channel.Title, URL: feedURL}}
+		}
+	}
+	return nil
+}
+
+// Collects the feed links in an HTML document, resolving them against its URL
+func feedLinks(body []byte, pageURL *url.URL) []feedCandidate {
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+
+	candidates := []feedCandidate{}
+	seen := map[string]bool{}
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// End of the document, or markup too broken to read further
+			return candidates
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		// Feed links live in the head, so there's no need to read the whole page
+		if token.DataAtom == atom.Body {
+			return candidates
+		}
+		if token.DataAtom != atom.Link {
+			continue
+		}
+
+		attrs := map[string]string{}
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = strings.TrimSpace(attr.Val)
+		}
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		linkType := strings.ToLower(attrs["type"])
+		if !slices.Contains(rels, "alternate") || !slices.Contains(feedLinkTypes, linkType) || attrs["href"] == "" {
+			continue
+		}
+
+		href, err := pageURL.Parse(attrs["href"])
+		if err != nil || seen[href.String()] {
+			continue
+		}
+		seen[href.String()] = true
+		candidates = append(candidates, feedCandidate{Title: attrs["title"], URL: href.String()})
+	}
+}
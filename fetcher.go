@@ -0,0 +1,319 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Luis-E-Ortega/gatorcli/internal/config"
+	"github.com/Luis-E-Ortega/gatorcli/internal/database"
+	"github.com/andybalholm/brotli"
+)
+
+// Defaults used for any fetcher setting left out of the config file
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+	defaultMaxBodyBytes   = 10 << 20 // 10 MiB
+	defaultMaxRedirects   = 5
+	// Keep well below what a shared host like Substack or Medium would consider abuse
+	defaultHostRequestsPerSecond = 1
+	defaultMaxConnsPerHost       = 2
+)
+
+// Used when a 429/503 response doesn't say how long to stay away
+const defaultRetryAfter = time.Hour
+
+// Downloads feeds with bounded timeouts, response sizes and redirects
+type fetcher struct {
+	client       *http.Client
+	limiter      *hostLimiter
+	readTimeout  time.Duration
+	maxBodyBytes int64
+}
+
+// Result of fetching a feed, along with the cache headers to send on the next request
+type fetchResult struct {
+	Feed         *RSSFeed
+	StatusCode   int
+	NotModified  bool
+	ETag         string
+	LastModified string
+	// Set when the feed was reached only through permanent (301/308) redirects
+	PermanentURL string
+}
+
+// Returned by fetchFeed when the server answers with an unexpected status code
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	// How long the server asked us to wait before trying again, if it did
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// Returned by fetchFeed when the response can't be parsed as a feed. Keeps the
+// document and where it came from so it can be searched for links to feeds
+type notAFeedError struct {
+	Err  error
+	Body []byte
+	URL  *url.URL
+}
+
+func (e *notAFeedError) Error() string {
+	return fmt.Sprintf("not a readable feed: %v", e.Err)
+}
+
+func (e *notAFeedError) Unwrap() error {
+	return e.Err
+}
+
+func newFetcher(cfg config.FetcherConfig) (*fetcher, error) {
+	connectTimeout, err := parseDurationSetting(cfg.ConnectTimeout, defaultConnectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connect_timeout: %w", err)
+	}
+	readTimeout, err := parseDurationSetting(cfg.ReadTimeout, defaultReadTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read_timeout: %w", err)
+	}
+
+	maxBodyBytes := cfg.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	hostRequestsPerSecond := cfg.HostRequestsPerSecond
+	if hostRequestsPerSecond <= 0 {
+		hostRequestsPerSecond = defaultHostRequestsPerSecond
+	}
+	maxConnsPerHost := cfg.MaxConnsPerHost
+	if maxConnsPerHost <= 0 {
+		maxConnsPerHost = defaultMaxConnsPerHost
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		MaxConnsPerHost:       maxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	return &fetcher{
+		client:       client,
+		limiter:      newHostLimiter(hostRequestsPerSecond, maxConnsPerHost),
+		readTimeout:  readTimeout,
+		maxBodyBytes: maxBodyBytes,
+	}, nil
+}
+
+func parseDurationSetting(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return timeout, nil
+}
+
+func (f *fetcher) fetchFeed(ctx context.Context, feed database.Feed) (*fetchResult, error) {
+	// Make a request using this method for more control to set headers
+	newReq, err := http.NewRequestWithContext(ctx, "GET", feed.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Set the specific header to our project name
+	newReq.Header.Set("User-Agent", "gator")
+	// Asking for compression ourselves turns off Go's transparent gzip handling,
+	// so the body is decoded in readBody instead
+	newReq.Header.Set("Accept-Encoding", "gzip, br")
+
+	// Let the server skip sending the body if nothing changed since the last fetch
+	if feed.Etag.Valid {
+		newReq.Header.Set("If-None-Match", feed.Etag.String)
+	}
+	if feed.LastModified.Valid {
+		newReq.Header.Set("If-Modified-Since", feed.LastModified.String)
+	}
+
+	// Wait for our turn with this host before sending anything
+	release, err := f.limiter.acquire(ctx, newReq.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := f.client.Do(newReq)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result := fetchResult{
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		PermanentURL: permanentRedirectURL(resp),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return &result, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		statusErr := &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, statusErr
+	}
+
+	body, err := f.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Feed, err = parseFeed(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, &notAFeedError{Err: err, Body: body, URL: resp.Request.URL}
+	}
+
+	return &result, nil
+}
+
+// Reads a decompressed response body, giving up if it's too slow or too large
+func (f *fetcher) readBody(resp *http.Response) ([]byte, error) {
+	// The header timeout doesn't cover the body, so stop a server trickling it out forever
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(f.readTimeout, func() {
+		timedOut.Store(true)
+		resp.Body.Close()
+	})
+	defer timer.Stop()
+
+	// Cap the compressed size as well so a bad server can't stream endlessly. Counting
+	// what comes off the wire tells a body cut off at the cap from a corrupt one
+	counter := &countingReader{reader: io.LimitReader(resp.Body, f.maxBodyBytes+1)}
+	var reader io.Reader = counter
+
+	// Closing the body or cutting it short makes the decoders fail with errors that
+	// don't say why, so report what actually happened instead
+	readErr := func(err error) error {
+		if timedOut.Load() {
+			return fmt.Errorf("timed out reading the response body after %v", f.readTimeout)
+		}
+		if counter.count > f.maxBodyBytes {
+			return fmt.Errorf("response body is larger than %d bytes", f.maxBodyBytes)
+		}
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, readErr(err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "br":
+		reader = brotli.NewReader(reader)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", resp.Header.Get("Content-Encoding"))
+	}
+
+	// Read one byte past the limit to tell a body of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(reader, f.maxBodyBytes+1))
+	if err != nil {
+		return nil, readErr(err)
+	}
+	if int64(len(body)) > f.maxBodyBytes || counter.count > f.maxBodyBytes {
+		return nil, fmt.Errorf("response body is larger than %d bytes", f.maxBodyBytes)
+	}
+
+	return body, nil
+}
+
+// Keeps count of the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// Parses a Retry-After header, which holds either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if retryAt, err := http.ParseTime(value); err == nil {
+		if retryAt.After(now) {
+			return retryAt.Sub(now)
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+// Returns the final URL of a response if every redirect leading to it was permanent
+func permanentRedirectURL(resp *http.Response) string {
+	redirected := false
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		code := req.Response.StatusCode
+		if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			return ""
+		}
+		redirected = true
+	}
+	if !redirected {
+		return ""
+	}
+	return resp.Request.URL.String()
+}
@@ -0,0 +1,52 @@
+package main
+
+import "flag"
+
+// Parses flags that may appear before, between or after positional arguments
+// (the flag package alone stops at the first positional one), returning the positional arguments.
+// Everything after a "--" terminator is positional, even if it starts with "-"
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		consumed := args[:len(args)-len(rest)]
+		if len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// Flag values for handlers, by name. The flags are declared in the command's
+// spec, so a missing one is a programming error and panics
+
+func (cmd command) stringFlag(name string) string {
+	return cmd.flags.Lookup(name).Value.String()
+}
+
+func (cmd command) intFlag(name string) int {
+	return cmd.flags.Lookup(name).Value.(flag.Getter).Get().(int)
+}
+
+func (cmd command) boolFlag(name string) bool {
+	return cmd.flags.Lookup(name).Value.(flag.Getter).Get().(bool)
+}
+
+// Reports whether a flag was given on the command line rather than left at its default
+func (cmd command) flagGiven(name string) bool {
+	set := false
+	cmd.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		limit      int
+		unread     bool
+		wantErr    bool
+	}{
+		{name: "no arguments", args: []string{}, positional: []string{}, limit: 2, unread: true},
+		{name: "flags before positionals", args: []string{"--limit", "5", "a", "b"}, positional: []string{"a", "b"}, limit: 5, unread: true},
+		{name: "flags between positionals", args: []string{"a", "--limit=5", "b", "--unread=false"}, positional: []string{"a", "b"}, limit: 5},
+		{name: "terminator before positionals", args: []string{"--", "pgbouncer", "-mysql"}, positional: []string{"pgbouncer", "-mysql"}, limit: 2, unread: true},
+		{name: "terminator after a positional", args: []string{"pgbouncer", "--limit", "3", "--", "-mysql", "--limit", "9"}, positional: []string{"pgbouncer", "-mysql", "--limit", "9"}, limit: 3, unread: true},
+		{name: "negative number after terminator", args: []string{"--", "-5"}, positional: []string{"-5"}, limit: 2, unread: true},
+		{name: "unknown flag", args: []string{"pgbouncer", "-mysql"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			limit := flags.Int("limit", 2, "")
+			unread := flags.Bool("unread", true, "")
+
+			positional, err := parseFlags(flags, tc.args)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got positionals %q", positional)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(positional, tc.positional) {
+				t.Errorf("positionals = %q, want %q", positional, tc.positional)
+			}
+			if *limit != tc.limit || *unread != tc.unread {
+				t.Errorf("limit = %d, unread = %v, want %d, %v", *limit, *unread, tc.limit, tc.unread)
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ module github.com/Luis-E-Ortega/gatorcli
 go 1.24.2
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
 	github.com/pressly/goose/v3 v3.24.3
+	golang.org/x/net v0.40.0
 )
 
 require (
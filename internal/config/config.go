@@ -7,8 +7,29 @@ import (
 )
 
 type Config struct {
-	DbUrl           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DbUrl           string        `json:"db_url"`
+	CurrentUserName string        `json:"current_user_name"`
+	Fetcher         FetcherConfig `json:"fetcher,omitempty"`
+	Polling         PollingConfig `json:"polling,omitempty"`
+}
+
+// Optional settings for downloading feeds, zero values fall back to the defaults.
+// Timeouts are duration strings such as "10s"
+type FetcherConfig struct {
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	ReadTimeout    string `json:"read_timeout,omitempty"`
+	MaxBodyBytes   int64  `json:"max_body_bytes,omitempty"`
+	MaxRedirects   int    `json:"max_redirects,omitempty"`
+	// Politeness limits applied to each host separately
+	HostRequestsPerSecond float64 `json:"host_requests_per_second,omitempty"`
+	MaxConnsPerHost       int     `json:"max_conns_per_host,omitempty"`
+}
+
+// Optional bounds for the polling interval agg learns for each feed,
+// given as duration strings such as "5m"
+type PollingConfig struct {
+	MinInterval string `json:"min_interval,omitempty"`
+	MaxInterval string `json:"max_interval,omitempty"`
 }
 
 func Read() (Config, error) {
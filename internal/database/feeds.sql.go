@@ -11,8 +11,77 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET last_fetched_at = $1, updated_at = $2, next_fetch_at = $3
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE next_fetch_at IS NULL OR next_fetch_at <= $4
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT $5
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days
+`
+
+type ClaimFeedsToFetchParams struct {
+	LastFetchedAt sql.NullTime
+	UpdatedAt     time.Time
+	LeaseUntil    sql.NullTime
+	DueAt         sql.NullTime
+	ClaimLimit    int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch,
+		arg.LastFetchedAt,
+		arg.UpdatedAt,
+		arg.LeaseUntil,
+		arg.DueAt,
+		arg.ClaimLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastHttpStatus,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.TtlMinutes,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -23,7 +92,7 @@ $4,
 $5,
 $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days
 `
 
 type CreateFeedParams struct {
@@ -53,6 +122,15 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.LastHttpStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.TtlMinutes,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
 	)
 	return i, err
 }
@@ -67,11 +145,11 @@ WITH inserted_feed_follow AS (
     $4,
     $5
     )
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, category
 )
 
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, 
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, inserted_feed_follow.category, 
     feeds.name AS feed_name, 
     users.name AS user_name
 FROM inserted_feed_follow
@@ -93,6 +171,7 @@ type CreateFeedFollowRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 	FeedName  string
 	UserName  string
 }
@@ -118,6 +197,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Category,
 			&i.FeedName,
 			&i.UserName,
 		); err != nil {
@@ -149,8 +229,92 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 	return err
 }
 
+const followFeedInCategory = `-- name: FollowFeedInCategory :execrows
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category)
+VALUES (
+$1,
+$2,
+$3,
+$4,
+$5,
+$6
+)
+ON CONFLICT (user_id, feed_id) DO NOTHING
+`
+
+type FollowFeedInCategoryParams struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.UUID
+	Category  sql.NullString
+}
+
+func (q *Queries) FollowFeedInCategory(ctx context.Context, arg FollowFeedInCategoryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, followFeedInCategory,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.FeedID,
+		arg.Category,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFailingFeeds = `-- name: GetFailingFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days
+FROM feeds
+WHERE consecutive_failures > 0
+ORDER BY consecutive_failures DESC, name
+`
+
+func (q *Queries) GetFailingFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFailingFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastHttpStatus,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.TtlMinutes,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days
 FROM feeds
 WHERE feeds.url = $1
 `
@@ -166,15 +330,32 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.LastError,
+		&i.LastHttpStatus,
+		&i.ConsecutiveFailures,
+		&i.NextFetchAt,
+		&i.TtlMinutes,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
 	)
 	return i, err
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 SELECT 
-    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_id, users.id, users.created_at, users.updated_at, users.name, feeds.id, feeds.created_at, feeds.updated_at, feeds.name, url, feeds.user_id, last_fetched_at, 
+    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_id, category, users.id, users.created_at, users.updated_at, users.name, feeds.id, feeds.created_at, feeds.updated_at, feeds.name, url, feeds.user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days, 
     feeds.name AS feed_name,
-    users.name AS user_name
+    users.name AS user_name,
+    (
+        SELECT count(*) FROM posts
+        WHERE posts.feed_id = feeds.id
+            AND NOT EXISTS (
+                SELECT 1 FROM post_reads
+                WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+            )
+    ) AS unread_count
 FROM feed_follows
 INNER JOIN users ON users.id = feed_follows.user_id
 INNER JOIN feeds ON feeds.id = feed_follows.feed_id
@@ -182,24 +363,35 @@ WHERE users.id = $1
 `
 
 type GetFeedFollowsForUserRow struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        uuid.UUID
-	FeedID        uuid.UUID
-	ID_2          uuid.UUID
-	CreatedAt_2   time.Time
-	UpdatedAt_2   time.Time
-	Name          string
-	ID_3          uuid.UUID
-	CreatedAt_3   time.Time
-	UpdatedAt_3   time.Time
-	Name_2        string
-	Url           string
-	UserID_2      uuid.UUID
-	LastFetchedAt sql.NullTime
-	FeedName      string
-	UserName      string
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	UserID              uuid.UUID
+	FeedID              uuid.UUID
+	Category            sql.NullString
+	ID_2                uuid.UUID
+	CreatedAt_2         time.Time
+	UpdatedAt_2         time.Time
+	Name                string
+	ID_3                uuid.UUID
+	CreatedAt_3         time.Time
+	UpdatedAt_3         time.Time
+	Name_2              string
+	Url                 string
+	UserID_2            uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	LastError           sql.NullString
+	LastHttpStatus      sql.NullInt32
+	ConsecutiveFailures int32
+	NextFetchAt         sql.NullTime
+	TtlMinutes          sql.NullInt32
+	SkipHours           []int32
+	SkipDays            []string
+	FeedName            string
+	UserName            string
+	UnreadCount         int64
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, id uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -217,6 +409,7 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, id uuid.UUID) ([]Ge
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Category,
 			&i.ID_2,
 			&i.CreatedAt_2,
 			&i.UpdatedAt_2,
@@ -228,8 +421,18 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, id uuid.UUID) ([]Ge
 			&i.Url,
 			&i.UserID_2,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastHttpStatus,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.TtlMinutes,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
 			&i.FeedName,
 			&i.UserName,
+			&i.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
@@ -279,26 +482,50 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+const getFeedsByName = `-- name: GetFeedsByName :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, last_error, last_http_status, consecutive_failures, next_fetch_at, ttl_minutes, skip_hours, skip_days
 FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1
+WHERE feeds.name = $1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-	)
-	return i, err
+func (q *Queries) GetFeedsByName(ctx context.Context, name string) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.LastError,
+			&i.LastHttpStatus,
+			&i.ConsecutiveFailures,
+			&i.NextFetchAt,
+			&i.TtlMinutes,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
@@ -317,3 +544,116 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams
 	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.LastFetchedAt, arg.UpdatedAt, arg.ID)
 	return err
 }
+
+const recordFeedFetchFailure = `-- name: RecordFeedFetchFailure :exec
+UPDATE feeds
+SET last_error = $1, last_http_status = $2, consecutive_failures = consecutive_failures + 1, next_fetch_at = $3, updated_at = $4
+WHERE id = $5
+`
+
+type RecordFeedFetchFailureParams struct {
+	LastError      sql.NullString
+	LastHttpStatus sql.NullInt32
+	NextFetchAt    sql.NullTime
+	UpdatedAt      time.Time
+	ID             uuid.UUID
+}
+
+func (q *Queries) RecordFeedFetchFailure(ctx context.Context, arg RecordFeedFetchFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFetchFailure,
+		arg.LastError,
+		arg.LastHttpStatus,
+		arg.NextFetchAt,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const recordFeedFetchSuccess = `-- name: RecordFeedFetchSuccess :exec
+UPDATE feeds
+SET last_error = NULL, last_http_status = $1, consecutive_failures = 0, next_fetch_at = $2, updated_at = $3
+WHERE id = $4
+`
+
+type RecordFeedFetchSuccessParams struct {
+	LastHttpStatus sql.NullInt32
+	NextFetchAt    sql.NullTime
+	UpdatedAt      time.Time
+	ID             uuid.UUID
+}
+
+func (q *Queries) RecordFeedFetchSuccess(ctx context.Context, arg RecordFeedFetchSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFetchSuccess,
+		arg.LastHttpStatus,
+		arg.NextFetchAt,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const updateFeedCacheHeaders = `-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $1, last_modified = $2, updated_at = $3
+WHERE id = $4
+`
+
+type UpdateFeedCacheHeadersParams struct {
+	Etag         sql.NullString
+	LastModified sql.NullString
+	UpdatedAt    time.Time
+	ID           uuid.UUID
+}
+
+func (q *Queries) UpdateFeedCacheHeaders(ctx context.Context, arg UpdateFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheHeaders,
+		arg.Etag,
+		arg.LastModified,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const updateFeedScheduleHints = `-- name: UpdateFeedScheduleHints :exec
+UPDATE feeds
+SET ttl_minutes = $1, skip_hours = $2, skip_days = $3, updated_at = $4
+WHERE id = $5
+`
+
+type UpdateFeedScheduleHintsParams struct {
+	TtlMinutes sql.NullInt32
+	SkipHours  []int32
+	SkipDays   []string
+	UpdatedAt  time.Time
+	ID         uuid.UUID
+}
+
+func (q *Queries) UpdateFeedScheduleHints(ctx context.Context, arg UpdateFeedScheduleHintsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedScheduleHints,
+		arg.TtlMinutes,
+		pq.Array(arg.SkipHours),
+		pq.Array(arg.SkipDays),
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $1, updated_at = $2
+WHERE id = $3
+`
+
+type UpdateFeedURLParams struct {
+	Url       string
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.Url, arg.UpdatedAt, arg.ID)
+	return err
+}
@@ -12,13 +12,22 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	LastError           sql.NullString
+	LastHttpStatus      sql.NullInt32
+	ConsecutiveFailures int32
+	NextFetchAt         sql.NullTime
+	TtlMinutes          sql.NullInt32
+	SkipHours           []int32
+	SkipDays            []string
 }
 
 type FeedFollow struct {
@@ -27,6 +36,7 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 }
 
 type Post struct {
@@ -38,6 +48,20 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	Search      interface{}
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	StarredAt time.Time
 }
 
 type User struct {
@@ -13,8 +13,109 @@ import (
 	"github.com/google/uuid"
 )
 
+const browsePostsForUser = `-- name: BrowsePostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1
+    AND ($2::uuid IS NULL OR posts.feed_id = $2)
+    AND ($3::timestamp IS NULL OR posts.published_at >= $3)
+    AND ($4::timestamp IS NULL OR posts.published_at < $4)
+    AND (NOT $5::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    ))
+    AND (NOT $6::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    ))
+    AND (
+        $7::timestamp IS NULL
+        OR ($8::bool AND (posts.published_at, posts.id) > ($7, $9::uuid))
+        OR (NOT $8::bool AND (posts.published_at, posts.id) < ($7, $9::uuid))
+    )
+ORDER BY
+    CASE WHEN $8::bool THEN posts.published_at END ASC,
+    CASE WHEN $8::bool THEN posts.id END ASC,
+    posts.published_at DESC,
+    posts.id DESC
+LIMIT $10
+OFFSET $11
+`
+
+type BrowsePostsForUserParams struct {
+	UserID           uuid.UUID
+	FeedID           uuid.NullUUID
+	Since            sql.NullTime
+	Until            sql.NullTime
+	UnreadOnly       bool
+	StarredOnly      bool
+	AfterPublishedAt sql.NullTime
+	OldestFirst      bool
+	AfterID          uuid.NullUUID
+	ResultLimit      int32
+	ResultOffset     int32
+}
+
+type BrowsePostsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+}
+
+func (q *Queries) BrowsePostsForUser(ctx context.Context, arg BrowsePostsForUserParams) ([]BrowsePostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, browsePostsForUser,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.UnreadOnly,
+		arg.StarredOnly,
+		arg.AfterPublishedAt,
+		arg.OldestFirst,
+		arg.AfterID,
+		arg.ResultLimit,
+		arg.ResultOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BrowsePostsForUserRow
+	for rows.Next() {
+		var i BrowsePostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid)
 VALUES (
 $1,
 $2,
@@ -23,9 +124,18 @@ $4,
 $5,
 $6,
 $7,
-$8
+$8,
+$9
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, (xmax = 0) AS inserted
 `
 
 type CreatePostParams struct {
@@ -37,9 +147,23 @@ type CreatePostParams struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
+type CreatePostRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	Inserted    bool
+}
+
+func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (CreatePostRow, error) {
 	row := q.db.QueryRowContext(ctx, createPost,
 		arg.ID,
 		arg.CreatedAt,
@@ -49,8 +173,44 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Guid,
+	)
+	var i CreatePostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.Inserted,
 	)
-	var i Post
+	return i, err
+}
+
+const getPost = `-- name: GetPost :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, guid FROM posts
+WHERE id = $1
+`
+
+type GetPostRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+}
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (GetPostRow, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i GetPostRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -60,34 +220,281 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Guid,
 	)
 	return i, err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id
+const getPostsByURLForUser = `-- name: GetPostsByURLForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
 FROM posts
-JOIN feeds ON posts.feed_id = feeds.id
-JOIN feed_follows ON feeds.id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1 AND posts.url = $2
 ORDER BY posts.published_at DESC
+`
+
+type GetPostsByURLForUserParams struct {
+	UserID uuid.UUID
+	Url    string
+}
+
+type GetPostsByURLForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+}
+
+func (q *Queries) GetPostsByURLForUser(ctx context.Context, arg GetPostsByURLForUserParams) ([]GetPostsByURLForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsByURLForUser, arg.UserID, arg.Url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsByURLForUserRow
+	for rows.Next() {
+		var i GetPostsByURLForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentPostDatesForFeed = `-- name: GetRecentPostDatesForFeed :many
+SELECT published_at
+FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
+LIMIT $2
+`
+
+type GetRecentPostDatesForFeedParams struct {
+	FeedID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) GetRecentPostDatesForFeed(ctx context.Context, arg GetRecentPostDatesForFeedParams) ([]time.Time, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPostDatesForFeed, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []time.Time
+	for rows.Next() {
+		var published_at time.Time
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStarredPostsForUser = `-- name: GetStarredPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
+FROM posts
+JOIN post_stars ON post_stars.post_id = posts.id
+WHERE post_stars.user_id = $1
+ORDER BY post_stars.starred_at DESC
 LIMIT $2
 `
 
-type GetPostsForUserParams struct {
+type GetStarredPostsForUserParams struct {
 	UserID uuid.UUID
 	Limit  int32
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+type GetStarredPostsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+}
+
+func (q *Queries) GetStarredPostsForUser(ctx context.Context, arg GetStarredPostsForUserParams) ([]GetStarredPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStarredPostsForUserRow
+	for rows.Next() {
+		var i GetStarredPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPostRead = `-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostReadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+func (q *Queries) MarkPostRead(ctx context.Context, arg MarkPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, markPostRead, arg.UserID, arg.PostID, arg.ReadAt)
+	return err
+}
+
+const markPostUnread = `-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2
+`
+
+type MarkPostUnreadParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) MarkPostUnread(ctx context.Context, arg MarkPostUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostUnread, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostsRead = `-- name: MarkPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, $1::timestamp
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $2
+    AND posts.published_at < $3::timestamp
+    AND ($4::uuid IS NULL OR posts.feed_id = $4)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostsReadParams struct {
+	ReadAt time.Time
+	UserID uuid.UUID
+	Before time.Time
+	FeedID uuid.NullUUID
+}
+
+func (q *Queries) MarkPostsRead(ctx context.Context, arg MarkPostsReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostsRead,
+		arg.ReadAt,
+		arg.UserID,
+		arg.Before,
+		arg.FeedID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, ts_rank(posts.search, query)::real AS rank, feeds.name AS feed_name
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON feeds.id = feed_follows.feed_id
+CROSS JOIN websearch_to_tsquery('english', $1) AS query
+WHERE feed_follows.user_id = $2
+    AND posts.search @@ query
+    AND ($3::uuid IS NULL OR posts.feed_id = $3)
+    AND ($4::timestamp IS NULL OR posts.published_at >= $4)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $5
+`
+
+type SearchPostsForUserParams struct {
+	Query       string
+	UserID      uuid.UUID
+	FeedID      uuid.NullUUID
+	Since       sql.NullTime
+	ResultLimit int32
+}
+
+type SearchPostsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	Rank        float32
+	FeedName    string
+}
+
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser,
+		arg.Query,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.ResultLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -97,6 +504,9 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.Rank,
+			&i.FeedName,
 		); err != nil {
 			return nil, err
 		}
@@ -110,3 +520,38 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const starPost = `-- name: StarPost :exec
+INSERT INTO post_stars (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type StarPostParams struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	StarredAt time.Time
+}
+
+func (q *Queries) StarPost(ctx context.Context, arg StarPostParams) error {
+	_, err := q.db.ExecContext(ctx, starPost, arg.UserID, arg.PostID, arg.StarredAt)
+	return err
+}
+
+const unstarPost = `-- name: UnstarPost :execrows
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2
+`
+
+type UnstarPostParams struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+}
+
+func (q *Queries) UnstarPost(ctx context.Context, arg UnstarPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unstarPost, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            jsonFeedID `json:"id"`
+	URL           string     `json:"url"`
+	ExternalURL   string     `json:"external_url"`
+	Title         string     `json:"title"`
+	ContentHTML   string     `json:"content_html"`
+	ContentText   string     `json:"content_text"`
+	Summary       string     `json:"summary"`
+	DatePublished string     `json:"date_published"`
+	DateModified  string     `json:"date_modified"`
+}
+
+// The spec says ids should be strings but that readers must accept other values,
+// such as numbers, by converting them to strings. A null id is left empty
+type jsonFeedID string
+
+func (id *jsonFeedID) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*id = jsonFeedID(text)
+		return nil
+	}
+	// Numbers and other values keep their JSON text, e.g. 1 becomes "1"
+	*id = jsonFeedID(bytes.TrimSpace(data))
+	return nil
+}
+
+// Parses a JSON Feed (jsonfeed.org) document and maps it onto the RSSFeed structure
+func parseJSONFeed(body []byte) (*RSSFeed, error) {
+	jsonFeed := JSONFeed{}
+	// encoding/json rejects the byte order mark some servers put in front of the document
+	err := json.Unmarshal(bytes.TrimPrefix(body, []byte("\ufeff")), &jsonFeed)
+	if err != nil {
+		return nil, err
+	}
+	// The version URL is the only thing telling a JSON Feed apart from any other JSON document
+	if !strings.HasPrefix(jsonFeed.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("unsupported feed format: JSON document is not a JSON Feed")
+	}
+
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = jsonFeed.Title
+	rssFeed.Channel.Link = jsonFeed.HomePageURL
+	rssFeed.Channel.Description = jsonFeed.Description
+
+	for _, item := range jsonFeed.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+
+		// Match the other formats by preferring the short summary over the full content
+		description := item.Summary
+		if description == "" {
+			description = item.ContentHTML
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			GUID:        string(item.ID),
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			PubDate:     pubDate,
+		})
+	}
+
+	return &rssFeed, nil
+}
@@ -3,13 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/xml"
 	"errors"
+	"flag"
 	"fmt"
-	"html"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"time"
 
@@ -26,10 +23,17 @@ type RSSFeed struct {
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+		// Scheduling hints, kept as strings since feeds often fill them in sloppily
+		TTL             string   `xml:"ttl"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
+	GUID        string `xml:"guid"`
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
@@ -48,72 +52,113 @@ func main() {
 	currentState := state{}
 	currentState.cfg = &data
 
-	// Open the channel to the database
-	db, err := sql.Open("postgres", data.DbUrl)
-	if err != nil {
-		fmt.Println("Error opening database channel")
-		os.Exit(1)
-	}
-	err = db.Ping() // Ping check to ensure connection is active
-	if err != nil {
-		fmt.Printf("Error caused by failed ping: %v", err)
-		os.Exit(1)
-	}
-
-	// Save the open database channel to state
-	currentState.RawDB = db
-
-	dbQueries := database.New(db)
-	currentState.db = dbQueries
-	if currentState.db == nil {
-		fmt.Println("Error caused by database having a nil pointer")
-		os.Exit(1)
-	}
-
 	cmds := commands{
-		allCommands: make(map[string]func(*state, command) error),
+		allCommands: make(map[string]commandSpec),
+	}
+
+	cmds.register("help", commandSpec{args: "[command]", description: "List the commands, or show how to use one", maxArgs: 1, handler: cmds.help})
+	cmds.register("login", commandSpec{args: "<name>", description: "Log in as a user that already exists", minArgs: 1, maxArgs: 1, handler: handlerLogin})
+	cmds.register("register", commandSpec{args: "<name>", description: "Create a user and log in as them", minArgs: 1, maxArgs: 1, handler: handlerRegister})
+	cmds.register("reset", commandSpec{description: "Reset the database by running the migrations down and up", handler: cmds.reset})
+	cmds.register("users", commandSpec{description: "List all users", handler: cmds.users})
+	cmds.register("agg", commandSpec{args: "[interval]", description: "Fetch feeds every interval (e.g. 1m), or once with --once", maxArgs: 1, flags: aggFlags, handler: cmds.agg})
+	cmds.register("addfeed", commandSpec{args: "[name] <url>", description: "Add a feed by its feed or website URL and follow it", minArgs: 1, maxArgs: 2, handler: middlewareLoggedIn(cmds.handlerAddfeed)})
+	cmds.register("feeds", commandSpec{description: "List all feeds", handler: cmds.feeds})
+	cmds.register("follow", commandSpec{args: "<url>", description: "Follow a feed that has already been added, by its feed or website URL", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.follow)})
+	cmds.register("following", commandSpec{description: "List the feeds you follow with their unread counts", handler: middlewareLoggedIn(cmds.following)})
+	cmds.register("unfollow", commandSpec{args: "<url>", description: "Unfollow a feed", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.unfollow)})
+	cmds.register("browse", commandSpec{args: "[limit]", description: "Show posts from the feeds you follow", maxArgs: 1, flags: browseFlags, handler: cmds.browse})
+	cmds.register("feedstatus", commandSpec{description: "List feeds that are failing to fetch", handler: cmds.feedstatus})
+	cmds.register("refresh", commandSpec{args: "<url|name>", description: "Fetch a single feed right away", minArgs: 1, maxArgs: 1, handler: cmds.refresh})
+	cmds.register("import", commandSpec{args: "<file.opml>", description: "Add and follow the feeds in an OPML file", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.importOPML)})
+	cmds.register("export", commandSpec{args: "[file.opml]", description: "Write the feeds you follow as OPML to a file or stdout", maxArgs: 1, flags: exportFlags, handler: middlewareLoggedIn(cmds.export)})
+	cmds.register("read", commandSpec{args: "<post id|url>", description: "Mark a post as read", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.read)})
+	cmds.register("unread", commandSpec{args: "<post id|url>", description: "Mark a post as unread", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.unread)})
+	cmds.register("markread", commandSpec{description: "Mark posts as read in bulk", flags: markreadFlags, handler: middlewareLoggedIn(cmds.markread)})
+	cmds.register("star", commandSpec{args: "<post id|url>", description: "Star a post to keep it", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.star)})
+	cmds.register("unstar", commandSpec{args: "<post id|url>", description: "Remove the star from a post", minArgs: 1, maxArgs: 1, handler: middlewareLoggedIn(cmds.unstar)})
+	cmds.register("starred", commandSpec{args: "[limit]", description: "List starred posts", maxArgs: 1, handler: middlewareLoggedIn(cmds.starred)})
+	cmds.register("search", commandSpec{args: "[--] <query>...", description: "Search the posts in the feeds you follow. Put -- before a query that excludes words with -word", minArgs: 1, maxArgs: -1, flags: searchFlags, handler: middlewareLoggedIn(cmds.search)})
+
+	output, userInput, err := extractOutputFlag(os.Args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
 	}
-
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", cmds.reset)
-	cmds.register("users", cmds.users)
-	cmds.register("agg", cmds.agg)
-	cmds.register("addfeed", middlewareLoggedIn(cmds.handlerAddfeed))
-	cmds.register("feeds", cmds.feeds)
-	cmds.register("follow", middlewareLoggedIn(cmds.follow))
-	cmds.register("following", middlewareLoggedIn(cmds.following))
-	cmds.register("unfollow", middlewareLoggedIn(cmds.unfollow))
-	cmds.register("browse", cmds.browse)
-
-	userInput := os.Args
+	currentState.output = output
+	// With no command, show what there is to run
 	if len(userInput) < 2 {
-		println("not enough arguments")
-		os.Exit(1)
+		cmds.help(&currentState, command{})
+		os.Exit(2)
 	}
 
 	cmdName := userInput[1]
 	cmdArgs := userInput[2:]
 
-	cmd := command{
+	spec, cmd, err := cmds.parse(command{
 		name:      cmdName,
 		arguments: cmdArgs,
+	})
+	if errors.Is(err, flag.ErrHelp) {
+		cmds.printCommandHelp(cmdName, spec)
+		return
+	}
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Help is answered without connecting to the database
+	if cmdName != "help" {
+		// Open the channel to the database
+		db, err := sql.Open("postgres", data.DbUrl)
+		if err != nil {
+			fmt.Println("Error opening database channel")
+			os.Exit(1)
+		}
+		err = db.Ping() // Ping check to ensure connection is active
+		if err != nil {
+			fmt.Printf("Error caused by failed ping: %v", err)
+			os.Exit(1)
+		}
+
+		// Save the open database channel to state
+		currentState.RawDB = db
+
+		// Set up the HTTP fetcher shared by every command that downloads feeds
+		currentState.fetcher, err = newFetcher(data.Fetcher)
+		if err != nil {
+			fmt.Printf("Error in fetcher config: %v\n", err)
+			os.Exit(1)
+		}
+		currentState.polling, err = newPollingBounds(data.Polling)
+		if err != nil {
+			fmt.Printf("Error in polling config: %v\n", err)
+			os.Exit(1)
+		}
+
+		dbQueries := database.New(db)
+		currentState.db = dbQueries
+		if currentState.db == nil {
+			fmt.Println("Error caused by database having a nil pointer")
+			os.Exit(1)
+		}
 	}
 
-	err = cmds.run(&currentState, cmd)
+	err = cmds.run(&currentState, spec, cmd)
+	if errors.As(err, &usageErr) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
 	if err != nil {
-		fmt.Printf("Error running command: %v", err)
+		fmt.Printf("Error running command: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 // Moved to here from commands because it was not working there
 func handlerRegister(s *state, cmd command) error {
-	// Check to ensure name isn't empty
-	if len(cmd.arguments) < 1 {
-		return errors.New("name required")
-	}
-
 	params := database.CreateUserParams{
 		Name:      cmd.arguments[0],
 		ID:        uuid.New(),
@@ -141,44 +186,3 @@ func handlerRegister(s *state, cmd command) error {
 
 	return nil
 }
-
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	rssFeed := RSSFeed{}
-
-	// Make a request using this method for more control to set headers
-	newReq, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	// Set the specific header to our project name
-	newReq.Header.Set("User-Agent", "gator")
-
-	// Create client
-	client := http.Client{}
-
-	resp, err := client.Do(newReq)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = xml.Unmarshal(body, &rssFeed)
-	if err != nil {
-		return nil, err
-	}
-
-	rssFeed.Channel.Title = html.UnescapeString(rssFeed.Channel.Title)
-	rssFeed.Channel.Description = html.UnescapeString(rssFeed.Channel.Description)
-
-	for i := range rssFeed.Channel.Item {
-		rssFeed.Channel.Item[i].Title = html.UnescapeString(rssFeed.Channel.Item[i].Title)
-		rssFeed.Channel.Item[i].Description = html.UnescapeString(rssFeed.Channel.Item[i].Description)
-	}
-
-	return &rssFeed, nil
-}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Luis-E-Ortega/gatorcli/internal/database"
+	"github.com/google/uuid"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// A feed subscription read from an OPML file, with the folders it was nested in
+type opmlEntry struct {
+	Name     string
+	URL      string
+	Category string
+}
+
+// Flattens the outline tree into feed entries. Folders are outlines without an
+// xmlUrl that hold other outlines, and nested folders are joined with "/".
+// Outlines that are neither feeds nor folders are returned as invalid
+func opmlEntries(outlines []OPMLOutline, category string) (entries []opmlEntry, invalid []string) {
+	for _, outline := range outlines {
+		name := strings.TrimSpace(outline.Title)
+		if name == "" {
+			name = strings.TrimSpace(outline.Text)
+		}
+
+		if outline.XMLURL == "" {
+			if len(outline.Outlines) == 0 {
+				invalid = append(invalid, fmt.Sprintf("'%s': no xmlUrl", name))
+				continue
+			}
+			folder := name
+			if category != "" {
+				folder = category + "/" + name
+			}
+			childEntries, childInvalid := opmlEntries(outline.Outlines, folder)
+			entries = append(entries, childEntries...)
+			invalid = append(invalid, childInvalid...)
+			continue
+		}
+
+		entries = append(entries, opmlEntry{
+			Name:     name,
+			URL:      strings.TrimSpace(outline.XMLURL),
+			Category: category,
+		})
+	}
+	return entries, invalid
+}
+
+// Imports the feeds from an OPML file, creating any that don't exist yet and
+// following them all for the logged in user, in a single transaction
+func (c *commands) importOPML(s *state, cmd command, user database.User) error {
+	data, err := os.ReadFile(cmd.arguments[0])
+	if err != nil {
+		return err
+	}
+	opml := OPML{}
+	err = xml.Unmarshal(data, &opml)
+	if err != nil {
+		return fmt.Errorf("failed to parse OPML file: %w", err)
+	}
+
+	entries, invalid := opmlEntries(opml.Body.Outlines, "")
+
+	ctx := context.Background()
+	tx, err := s.RawDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	added := []string{}
+	present := []string{}
+	for _, entry := range entries {
+		feedURL, err := url.Parse(entry.URL)
+		if err != nil || (feedURL.Scheme != "http" && feedURL.Scheme != "https") || feedURL.Host == "" {
+			invalid = append(invalid, fmt.Sprintf("'%s': invalid url %s", entry.Name, entry.URL))
+			continue
+		}
+		if entry.Name == "" {
+			entry.Name = entry.URL
+		}
+
+		now := time.Now()
+		feed, err := qtx.GetFeedByURL(ctx, entry.URL)
+		if err == nil {
+			present = append(present, entry.URL)
+		} else if errors.Is(err, sql.ErrNoRows) {
+			feed, err = qtx.CreateFeed(ctx, database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: now,
+				UpdatedAt: now,
+				Name:      entry.Name,
+				Url:       entry.URL,
+				UserID:    user.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create feed %s: %w", entry.URL, err)
+			}
+			added = append(added, entry.URL)
+		} else {
+			return err
+		}
+
+		// Feeds the user already follows keep their current category
+		_, err = qtx.FollowFeedInCategory(ctx, database.FollowFeedInCategoryParams{
+			ID:        uuid.New(),
+			CreatedAt: now,
+			UpdatedAt: now,
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+			Category:  sql.NullString{String: entry.Category, Valid: entry.Category != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to follow feed %s: %w", entry.URL, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	printReport("Added", added)
+	printReport("Already present", present)
+	printReport("Invalid", invalid)
+	return nil
+}
+
+func exportFlags(flags *flag.FlagSet) {
+	flags.Bool("opml", false, "write subscriptions as OPML 2.0")
+}
+
+// Writes the feeds the logged in user follows as an OPML 2.0 document, to the
+// given file or to stdout. Categories become folders, with "/" nesting them
+func (c *commands) export(s *state, cmd command, user database.User) error {
+	if !cmd.boolFlag("opml") {
+		return cmd.misuse(errors.New("export format required, use --opml"))
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	opml := OPML{Version: "2.0"}
+	opml.Head.Title = fmt.Sprintf("%s's feeds in gator", user.Name)
+	opml.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	for _, follow := range follows {
+		outline := OPMLOutline{
+			Text:   follow.FeedName,
+			Title:  follow.FeedName,
+			Type:   "rss",
+			XMLURL: follow.Url,
+		}
+		var folders []string
+		if follow.Category.Valid {
+			folders = strings.Split(follow.Category.String, "/")
+		}
+		opml.Body.Outlines = addOutline(opml.Body.Outlines, folders, outline)
+	}
+
+	data, err := xml.MarshalIndent(opml, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	data = append(data, '\n')
+
+	if len(cmd.arguments) > 0 {
+		return os.WriteFile(cmd.arguments[0], data, 0644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// Adds a feed outline under the given folder path, creating folders as needed
+func addOutline(outlines []OPMLOutline, folders []string, outline OPMLOutline) []OPMLOutline {
+	if len(folders) == 0 {
+		return append(outlines, outline)
+	}
+	for i := range outlines {
+		if outlines[i].XMLURL == "" && outlines[i].Text == folders[0] {
+			outlines[i].Outlines = addOutline(outlines[i].Outlines, folders[1:], outline)
+			return outlines
+		}
+	}
+	folder := OPMLOutline{Text: folders[0], Title: folders[0]}
+	folder.Outlines = addOutline(nil, folders[1:], outline)
+	return append(outlines, folder)
+}
+
+func printReport(heading string, lines []string) {
+	fmt.Printf("%s: %d\n", heading, len(lines))
+	for _, line := range lines {
+		fmt.Printf(" %s\n", line)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"strings"
+)
+
+// Parses a fetched feed document into the RSSFeed structure used by scrapeFeeds,
+// choosing the parser from the Content-Type header and the document itself
+func parseFeed(contentType string, body []byte) (*RSSFeed, error) {
+	var feed *RSSFeed
+	var err error
+	if isJSON(contentType, body) {
+		feed, err = parseJSONFeed(body)
+	} else {
+		feed, err = parseXMLFeed(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
+	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
+
+	for i := range feed.Channel.Item {
+		feed.Channel.Item[i].Title = html.UnescapeString(feed.Channel.Item[i].Title)
+		feed.Channel.Item[i].Description = html.UnescapeString(feed.Channel.Item[i].Description)
+	}
+
+	return feed, nil
+}
+
+// Parses an XML feed document, choosing the parser based on the root element
+func parseXMLFeed(body []byte) (*RSSFeed, error) {
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch root {
+	case "rss":
+		return parseRSS(body)
+	case "feed":
+		return parseAtom(body)
+	case "RDF":
+		return parseRDF(body)
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root)
+	}
+}
+
+// Reports whether a response body should be treated as JSON rather than XML.
+// Servers often send feeds with a generic or wrong Content-Type, so the body
+// is sniffed when the header is inconclusive
+func isJSON(contentType string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/feed+json" || mediaType == "application/json" {
+		return true
+	}
+	if strings.HasSuffix(mediaType, "xml") {
+		return false
+	}
+	trimmed := bytes.TrimLeft(body, "\ufeff \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// Returns the local name of the first element in an XML document
+func rootElement(body []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("could not find root element: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseRSS(body []byte) (*RSSFeed, error) {
+	rssFeed := RSSFeed{}
+	err := xml.Unmarshal(body, &rssFeed)
+	if err != nil {
+		return nil, err
+	}
+	return &rssFeed, nil
+}
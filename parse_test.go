@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFeed(t *testing.T) {
+	const rss = `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+<title>Plain RSS</title><link>https://example.com/</link><description>Notes</description>
+<item><guid>1</guid><title>First &amp;amp; best</title><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`
+
+	const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Atom feed</title><subtitle>Subtitle</subtitle>
+<link rel="self" href="https://example.com/atom.xml"/>
+<link href="https://example.com/"/>
+<entry>
+	<id>urn:1</id><title>Alternate links</title>
+	<link rel="edit" href="https://example.com/edit/1"/>
+	<link rel="alternate" type="application/pdf" href="https://example.com/1.pdf"/>
+	<link rel="alternate" type="text/html" href="https://example.com/1"/>
+	<updated>2006-01-02T15:04:05Z</updated>
+	<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div></content>
+</entry>
+<entry>
+	<id>urn:2</id><title>Only other links</title>
+	<link rel="alternate" type="application/pdf" href="https://example.com/2.pdf"/>
+	<published>2006-01-03T15:04:05Z</published><updated>2006-01-04T15:04:05Z</updated>
+	<summary>Short</summary><content type="html">&lt;p&gt;Long&lt;/p&gt;</content>
+</entry>
+</feed>`
+
+	const jsonFeed = `{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "JSON feed",
+	"home_page_url": "https://example.com/",
+	"items": [
+		{"id": 1, "url": "https://example.com/1", "title": "Numeric id", "content_html": "<p>Full</p>", "date_published": "2006-01-02T15:04:05Z"},
+		{"id": null, "external_url": "https://other.example/2", "title": "Null id", "content_text": "Text only", "date_modified": "2006-01-03T15:04:05Z"},
+		{"id": "three", "url": "https://example.com/3", "title": "Summary", "summary": "Short", "content_html": "<p>Long</p>"}
+	]
+}`
+
+	const rdf = `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel rdf:about="https://example.com/"><title>RDF feed</title><link>https://example.com/</link><description>Old school</description></channel>
+<item rdf:about="https://example.com/1"><title>With link</title><link>https://example.com/1?src=rss</link><description>One</description><dc:date>2006-01-02T15:04:05Z</dc:date></item>
+<item rdf:about="https://example.com/2"><title>Without link</title><dc:date>2006-01-03T15:04:05Z</dc:date></item>
+</rdf:RDF>`
+
+	rssItems := []RSSItem{
+		{GUID: "1", Title: "First & best", Link: "https://example.com/1", PubDate: "Mon, 02 Jan 2006 15:04:05 GMT"},
+	}
+	jsonItems := []RSSItem{
+		{GUID: "1", Title: "Numeric id", Link: "https://example.com/1", Description: "<p>Full</p>", PubDate: "2006-01-02T15:04:05Z"},
+		{GUID: "", Title: "Null id", Link: "https://other.example/2", Description: "Text only", PubDate: "2006-01-03T15:04:05Z"},
+		{GUID: "three", Title: "Summary", Link: "https://example.com/3", Description: "Short"},
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		title       string
+		link        string
+		items       []RSSItem
+		wantErr     bool
+	}{
+		{name: "rss", contentType: "application/rss+xml", body: rss, title: "Plain RSS", link: "https://example.com/", items: rssItems},
+		{name: "atom", contentType: "application/atom+xml", body: atom, title: "Atom feed", link: "https://example.com/", items: []RSSItem{
+			{GUID: "urn:1", Title: "Alternate links", Link: "https://example.com/1", Description: `<div xmlns="http://www.w3.org/1999/xhtml"><p>Hello <b>world</b></p></div>`, PubDate: "2006-01-02T15:04:05Z"},
+			{GUID: "urn:2", Title: "Only other links", Link: "https://example.com/2.pdf", Description: "Short", PubDate: "2006-01-03T15:04:05Z"},
+		}},
+		{name: "json feed", contentType: "application/feed+json", body: jsonFeed, title: "JSON feed", link: "https://example.com/", items: jsonItems},
+		{name: "rdf", contentType: "application/rdf+xml", body: rdf, title: "RDF feed", link: "https://example.com/", items: []RSSItem{
+			{GUID: "https://example.com/1", Title: "With link", Link: "https://example.com/1?src=rss", Description: "One", PubDate: "2006-01-02T15:04:05Z"},
+			{GUID: "https://example.com/2", Title: "Without link", Link: "https://example.com/2", PubDate: "2006-01-03T15:04:05Z"},
+		}},
+		{name: "json sniffed from a generic type", contentType: "text/plain; charset=utf-8", body: "\ufeff\n" + jsonFeed, title: "JSON feed", link: "https://example.com/", items: jsonItems},
+		{name: "json sniffed without a type", body: jsonFeed, title: "JSON feed", link: "https://example.com/", items: jsonItems},
+		{name: "xml sniffed from a wrong type", contentType: "text/html", body: rss, title: "Plain RSS", link: "https://example.com/", items: rssItems},
+		{name: "xml type wins over the body", contentType: "application/xml", body: jsonFeed, wantErr: true},
+		{name: "json that isn't a feed", contentType: "application/json", body: `{"title": "not a feed"}`, wantErr: true},
+		{name: "unsupported xml root", contentType: "text/xml", body: `<html><body>hi</body></html>`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			feed, err := parseFeed(tc.contentType, []byte(tc.body))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", feed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if feed.Channel.Title != tc.title || feed.Channel.Link != tc.link {
+				t.Errorf("channel = %q %q, want %q %q", feed.Channel.Title, feed.Channel.Link, tc.title, tc.link)
+			}
+			if !reflect.DeepEqual(feed.Channel.Item, tc.items) {
+				t.Errorf("items = %+v\nwant %+v", feed.Channel.Item, tc.items)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits how hard the fetcher hits any single host, using a token bucket for the
+// request rate and a semaphore for the number of concurrent connections
+type hostLimiter struct {
+	mu                sync.Mutex
+	requestsPerSecond float64
+	maxConns          int
+	hosts             map[string]*hostBucket
+}
+
+type hostBucket struct {
+	tokens     float64
+	lastRefill time.Time
+	conns      chan struct{}
+}
+
+func newHostLimiter(requestsPerSecond float64, maxConns int) *hostLimiter {
+	return &hostLimiter{
+		requestsPerSecond: requestsPerSecond,
+		maxConns:          maxConns,
+		hosts:             make(map[string]*hostBucket),
+	}
+}
+
+// Blocks until a request to host is allowed, returning a function that must be
+// called once the request is finished to free its connection slot
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	bucket, wait := l.reserve(host)
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case bucket.conns <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return func() { <-bucket.conns }, nil
+}
+
+// Takes a token from the host's bucket, returning how long to wait for it if the
+// bucket was empty. Tokens are handed out in order, so callers queue up fairly
+func (l *hostLimiter) reserve(host string) (*hostBucket, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.hosts[host]
+	if !ok {
+		bucket = &hostBucket{
+			tokens:     1,
+			lastRefill: now,
+			conns:      make(chan struct{}, l.maxConns),
+		}
+		l.hosts[host] = bucket
+	}
+
+	// Refill for the time since the last request, holding at most one token so
+	// requests are spread out rather than sent in bursts
+	bucket.tokens += now.Sub(bucket.lastRefill).Seconds() * l.requestsPerSecond
+	if bucket.tokens > 1 {
+		bucket.tokens = 1
+	}
+	bucket.lastRefill = now
+
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return bucket, 0
+	}
+	return bucket, time.Duration(-bucket.tokens / l.requestsPerSecond * float64(time.Second))
+}
@@ -0,0 +1,57 @@
+package main
+
+import "encoding/xml"
+
+// RSS 1.0 documents put their items next to the channel instead of inside it
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+	// Also picks up dc:description, which some RDF feeds use instead
+	Description string `xml:"description"`
+	DCDate      string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+// Parses an RSS 1.0 (RDF) document and maps it onto the RSSFeed structure
+func parseRDF(body []byte) (*RSSFeed, error) {
+	rdfFeed := RDFFeed{}
+	err := xml.Unmarshal(body, &rdfFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = rdfFeed.Channel.Title
+	rssFeed.Channel.Link = rdfFeed.Channel.Link
+	rssFeed.Channel.Description = rdfFeed.Channel.Description
+	rssFeed.Channel.UpdatePeriod = rdfFeed.Channel.UpdatePeriod
+	rssFeed.Channel.UpdateFrequency = rdfFeed.Channel.UpdateFrequency
+
+	for _, item := range rdfFeed.Item {
+		link := item.Link
+		if link == "" {
+			link = item.About
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        link,
+			Description: item.Description,
+			PubDate:     item.DCDate,
+		})
+	}
+
+	return &rssFeed, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+type outputFormat string
+
+const (
+	outputText  outputFormat = "text"
+	outputJSON  outputFormat = "json"
+	outputJSONL outputFormat = "jsonl"
+	outputCSV   outputFormat = "csv"
+	outputTable outputFormat = "table"
+)
+
+// Pulls the global --output flag out of the command line, wherever it appears
+// before a "--", so that commands with their own flags don't have to know about it.
+// Everything from "--" on is left for the command to treat as positional
+func extractOutputFlag(args []string) (outputFormat, []string, error) {
+	format := outputText
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--output" && name != "-output" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("--output needs a format")
+			}
+			i++
+			value = args[i]
+		}
+		switch outputFormat(value) {
+		case outputText, outputJSON, outputJSONL, outputCSV, outputTable:
+			format = outputFormat(value)
+		default:
+			return "", nil, fmt.Errorf("unknown output format '%s', use text, json, jsonl, csv or table", value)
+		}
+	}
+	return format, rest, nil
+}
+
+// A named value in a record, in the order the struct declares it
+type field struct {
+	Name  string
+	Value any
+}
+
+// Writes a listing in the output format chosen on the command line. records must
+// be a slice of structs; their fields become snake_case keys and columns, with
+// embedded structs flattened in. Text output keeps each command's own layout
+func (s *state) render(records any, text func()) error {
+	if s.output == "" || s.output == outputText {
+		text()
+		return nil
+	}
+	return renderRecords(os.Stdout, s.output, records)
+}
+
+func renderRecords(w io.Writer, format outputFormat, records any) error {
+	list := reflect.ValueOf(records)
+	if list.Kind() != reflect.Slice {
+		return fmt.Errorf("can't render %T, expected a slice", records)
+	}
+	rows := make([][]field, list.Len())
+	for i := range rows {
+		rows[i] = recordFields(list.Index(i))
+	}
+	columns := recordFields(reflect.New(list.Type().Elem()).Elem())
+
+	switch format {
+	case outputJSON:
+		objects := make([]json.RawMessage, len(rows))
+		for i, row := range rows {
+			object, err := jsonObject(row)
+			if err != nil {
+				return err
+			}
+			objects[i] = object
+		}
+		data, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case outputJSONL:
+		for _, row := range rows {
+			object, err := jsonObject(row)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n", object)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputCSV:
+		out := csv.NewWriter(w)
+		err := out.Write(columnNames(columns))
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			err = out.Write(cells(row))
+			if err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return out.Error()
+	case outputTable:
+		out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, strings.ToUpper(strings.Join(columnNames(columns), "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(out, strings.Join(cells(row), "\t"))
+		}
+		return out.Flush()
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+}
+
+// Collects the exported fields of a struct
+func recordFields(record reflect.Value) []field {
+	fields := []field{}
+	for i := 0; i < record.NumField(); i++ {
+		structField := record.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		if structField.Anonymous && structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, recordFields(record.Field(i))...)
+			continue
+		}
+		fields = append(fields, field{
+			Name:  snakeCase(structField.Name),
+			Value: plainValue(record.Field(i).Interface()),
+		})
+	}
+	return fields
+}
+
+// Unwraps database types (UUIDs and sql.Null* values) to what they hold, or nil
+func plainValue(value any) any {
+	if valuer, ok := value.(driver.Valuer); ok {
+		plain, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		return plain
+	}
+	return value
+}
+
+// Turns Go field names into column style names, e.g. LastHttpStatus into
+// last_http_status and FeedID into feed_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Marshals a record as a JSON object that keeps the field order
+func jsonObject(row []field) (json.RawMessage, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range row {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func columnNames(columns []field) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Formats a record's values for csv and table output. Missing values are empty
+// and lists are joined with ";"
+func cells(row []field) []string {
+	values := make([]string, len(row))
+	for i, f := range row {
+		values[i] = cell(f.Value)
+	}
+	return values
+}
+
+func cell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case string:
+		return v
+	}
+
+	list := reflect.ValueOf(value)
+	if list.Kind() == reflect.Slice {
+		items := make([]string, list.Len())
+		for i := range items {
+			items[i] = cell(list.Index(i).Interface())
+		}
+		return strings.Join(items, ";")
+	}
+	return fmt.Sprint(value)
+}
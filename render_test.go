@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractOutputFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		format  outputFormat
+		rest    []string
+		wantErr bool
+	}{
+		{name: "not given", args: []string{"gator", "browse"}, format: outputText, rest: []string{"gator", "browse"}},
+		{name: "before the command", args: []string{"gator", "--output", "csv", "following"}, format: outputCSV, rest: []string{"gator", "following"}},
+		{name: "after the command", args: []string{"gator", "browse", "--limit", "50", "-output=jsonl"}, format: outputJSONL, rest: []string{"gator", "browse", "--limit", "50"}},
+		{name: "after the terminator", args: []string{"gator", "search", "--", "logs", "-output"}, format: outputText, rest: []string{"gator", "search", "--", "logs", "-output"}},
+		{name: "before the terminator", args: []string{"gator", "search", "--output", "json", "--", "--output"}, format: outputJSON, rest: []string{"gator", "search", "--", "--output"}},
+		{name: "missing format", args: []string{"gator", "browse", "--output"}, wantErr: true},
+		{name: "unknown format", args: []string{"gator", "browse", "--output=xml"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			format, rest, err := extractOutputFlag(tc.args)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got format %q", format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != tc.format {
+				t.Errorf("format = %q, want %q", format, tc.format)
+			}
+			if !reflect.DeepEqual(rest, tc.rest) {
+				t.Errorf("rest = %q, want %q", rest, tc.rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Luis-E-Ortega/gatorcli/internal/config"
+	"github.com/Luis-E-Ortega/gatorcli/internal/database"
+)
+
+// Upper bound on a feed-declared interval, so a bogus ttl can't stop a feed from being polled
+const maxDeclaredInterval = 24 * time.Hour
+
+// Defaults for the range a feed's learned polling interval is kept within
+const (
+	defaultMinPollInterval = 5 * time.Minute
+	defaultMaxPollInterval = 24 * time.Hour
+)
+
+// How many of a feed's latest posts are used to learn how often it publishes
+const publishHistorySize = 20
+
+// Lengths of the sy:updatePeriod values, which sy:updateFrequency divides
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// How often a feed asks to be polled and when it asks to be left alone
+type scheduleHints struct {
+	TTLMinutes sql.NullInt32
+	SkipHours  []int32
+	SkipDays   []string
+}
+
+// Reads the scheduling hints declared in a parsed feed, ignoring values that don't make sense
+func parseScheduleHints(feed *RSSFeed) scheduleHints {
+	hints := scheduleHints{
+		SkipHours: []int32{},
+		SkipDays:  []string{},
+	}
+
+	// An explicit ttl wins over the syndication module's period and frequency
+	if ttl, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL)); err == nil && ttl > 0 {
+		hints.TTLMinutes = sql.NullInt32{Int32: int32(min(ttl, int(maxDeclaredInterval/time.Minute))), Valid: true}
+	} else if period, ok := updatePeriods[strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))]; ok {
+		frequency, err := strconv.Atoi(strings.TrimSpace(feed.Channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		interval := min(period/time.Duration(frequency), maxDeclaredInterval)
+		if interval >= time.Minute {
+			hints.TTLMinutes = sql.NullInt32{Int32: int32(interval / time.Minute), Valid: true}
+		}
+	}
+
+	// skipHours are GMT hours from 0 to 23, though some feeds write midnight as 24
+	for _, value := range feed.Channel.SkipHours {
+		hour, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || hour < 0 || hour > 24 {
+			continue
+		}
+		hour %= 24
+		if !slices.Contains(hints.SkipHours, int32(hour)) {
+			hints.SkipHours = append(hints.SkipHours, int32(hour))
+		}
+	}
+
+	for _, value := range feed.Channel.SkipDays {
+		day, ok := parseWeekday(value)
+		if ok && !slices.Contains(hints.SkipDays, day.String()) {
+			hints.SkipDays = append(hints.SkipDays, day.String())
+		}
+	}
+
+	return hints
+}
+
+func parseWeekday(value string) (time.Weekday, bool) {
+	value = strings.TrimSpace(value)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), value) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// Range the learned polling interval of every feed is kept within
+type pollingBounds struct {
+	min time.Duration
+	max time.Duration
+}
+
+func newPollingBounds(cfg config.PollingConfig) (pollingBounds, error) {
+	minInterval, err := parseDurationSetting(cfg.MinInterval, defaultMinPollInterval)
+	if err != nil {
+		return pollingBounds{}, fmt.Errorf("invalid min_interval: %w", err)
+	}
+	maxInterval, err := parseDurationSetting(cfg.MaxInterval, defaultMaxPollInterval)
+	if err != nil {
+		return pollingBounds{}, fmt.Errorf("invalid max_interval: %w", err)
+	}
+	if minInterval > maxInterval {
+		return pollingBounds{}, errors.New("min_interval is longer than max_interval")
+	}
+	return pollingBounds{min: minInterval, max: maxInterval}, nil
+}
+
+// Learns how often a feed should be polled from the publish dates of its latest posts
+// (newest first), aiming for about two polls per expected new post
+func (b pollingBounds) learnInterval(publishedAt []time.Time, now time.Time) time.Duration {
+	// Not enough history to tell, most likely a dead or brand new feed
+	if len(publishedAt) < 2 {
+		return b.max
+	}
+
+	newest := publishedAt[0]
+	oldest := publishedAt[len(publishedAt)-1]
+	gap := newest.Sub(oldest) / time.Duration(len(publishedAt)-1)
+
+	// A feed that has gone quiet for longer than usual is slowing down
+	gap = max(gap, now.Sub(newest))
+
+	return min(max(gap/2, b.min), b.max)
+}
+
+// Works out when a feed should next be fetched after a successful fetch at now,
+// waiting for whichever is longer of its declared ttl and its learned interval
+func nextFetchTime(feed database.Feed, learned time.Duration, now time.Time) sql.NullTime {
+	interval := learned
+	if feed.TtlMinutes.Valid {
+		interval = max(interval, time.Duration(feed.TtlMinutes.Int32)*time.Minute)
+	}
+	next := now.Add(interval)
+
+	// Move past any skipped hours and days, which are given in GMT. A week of
+	// hours is enough to get past every combination that leaves any time open
+	for i := 0; i < 7*24 && isSkipped(feed, next); i++ {
+		next = next.UTC().Truncate(time.Hour).Add(time.Hour).In(now.Location())
+	}
+
+	return sql.NullTime{Time: next, Valid: true}
+}
+
+func isSkipped(feed database.Feed, t time.Time) bool {
+	utc := t.UTC()
+	return slices.Contains(feed.SkipHours, int32(utc.Hour())) || slices.Contains(feed.SkipDays, utc.Weekday().String())
+}
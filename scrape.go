@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Luis-E-Ortega/gatorcli/internal/database"
+	"github.com/google/uuid"
+)
+
+// Bounds for how long a failing feed is left alone before it's retried
+const (
+	minFetchBackoff = 5 * time.Minute
+	maxFetchBackoff = 24 * time.Hour
+)
+
+// A claimed feed is pushed this far into the future so no other agg process
+// picks it up while it's being fetched. Fetches are cut off well before the
+// lease runs out, and recording the outcome replaces it with the real schedule
+const (
+	claimLease       = 10 * time.Minute
+	maxFetchDuration = 5 * time.Minute
+)
+
+// How many posts a single scrape of a feed added, changed or found already stored
+type scrapeStats struct {
+	New     int
+	Updated int
+	Skipped int
+}
+
+// Outcome of scraping one feed as part of a batch
+type scrapeOutcome struct {
+	Feed  database.Feed
+	Stats scrapeStats
+	Err   error
+}
+
+// Used by agg to fetch feeds and keep database updated while running.
+// Claims the stalest feeds (up to one per worker) and fetches them in parallel
+func (c *commands) scrapeFeeds(ctx context.Context, s *state, workers int) error {
+	outcomes, err := c.scrapeDueFeeds(ctx, s, workers)
+	if err != nil {
+		return err
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			fmt.Printf("Error scraping feed %s: %v\n", outcome.Feed.Url, outcome.Err)
+		}
+	}
+	return nil
+}
+
+// Claims up to one due feed per worker and scrapes them in parallel
+func (c *commands) scrapeDueFeeds(ctx context.Context, s *state, workers int) ([]scrapeOutcome, error) {
+	now := time.Now()
+	// Claiming marks the feeds as fetched and leases them in the same statement, and
+	// skips rows another agg process is claiming, so two processes never fetch the same feed
+	feeds, err := s.db.ClaimFeedsToFetch(
+		ctx,
+		database.ClaimFeedsToFetchParams{
+			LastFetchedAt: sql.NullTime{Time: now, Valid: true},
+			UpdatedAt:     now,
+			LeaseUntil:    sql.NullTime{Time: now.Add(claimLease), Valid: true},
+			DueAt:         sql.NullTime{Time: now, Valid: true},
+			ClaimLimit:    int32(workers),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hand the claimed feeds out to the workers, each outcome keeping the feed's position
+	outcomes := make([]scrapeOutcome, len(feeds))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(feeds)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				stats, err := c.scrapeFeed(ctx, s, feeds[i], now)
+				outcomes[i] = scrapeOutcome{Feed: feeds[i], Stats: stats, Err: err}
+			}
+		}()
+	}
+	for i := range feeds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return outcomes, nil
+}
+
+// Fetches a single feed that has already been marked as fetched and stores its posts
+func (c *commands) scrapeFeed(ctx context.Context, s *state, feed database.Feed, now time.Time) (scrapeStats, error) {
+	stats := scrapeStats{}
+
+	// Give up on the fetch long before the feed's lease runs out
+	fetchCtx, cancel := context.WithTimeout(ctx, maxFetchDuration)
+	defer cancel()
+	result, err := s.fetcher.fetchFeed(fetchCtx, feed)
+	if err != nil {
+		// Being interrupted by a shutdown says nothing about the feed itself
+		if ctx.Err() != nil {
+			return stats, err
+		}
+		return stats, c.recordFetchFailure(ctx, s, feed, now, err)
+	}
+
+	// Follow the publisher when they permanently move their feed
+	if result.PermanentURL != "" && result.PermanentURL != feed.Url {
+		err = s.db.UpdateFeedURL(
+			ctx,
+			database.UpdateFeedURLParams{
+				Url:       result.PermanentURL,
+				UpdatedAt: now,
+				ID:        feed.ID,
+			},
+		)
+		if err != nil {
+			// Most likely another feed already uses the new URL, keep the old one
+			log.Printf("failed to move feed %s to %s: %v", feed.Url, result.PermanentURL, err)
+		} else {
+			fmt.Printf("Feed %s moved permanently to %s\n", feed.Url, result.PermanentURL)
+		}
+	}
+	// Nothing changed since the last fetch, so marking it fetched is all there is to do
+	if result.NotModified {
+		return stats, c.recordFetchSuccess(ctx, s, s.db, feed, now, result)
+	}
+
+	feed, stats, err = storeFetchResult(ctx, s.db, nil, feed, result, now)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, c.recordFetchSuccess(ctx, s, s.db, feed, now, result)
+}
+
+// Stores the posts and scheduling hints of a fetched feed, along with the cache headers
+// for the next fetch. Returns the feed updated with its new hints.
+// When q runs inside tx, each post is stored under a savepoint, since a failed
+// statement would otherwise abort the rest of the transaction
+func storeFetchResult(ctx context.Context, q *database.Queries, tx *sql.Tx, feed database.Feed, result *fetchResult, now time.Time) (database.Feed, scrapeStats, error) {
+	stats := scrapeStats{}
+	failedPosts := 0
+
+	for _, item := range result.Feed.Channel.Item {
+		// Stop early if agg gave up waiting for this fetch during shutdown
+		if ctx.Err() != nil {
+			return feed, stats, ctx.Err()
+		}
+
+		// Items are identified by their guid, falling back to the link for feeds without one
+		guid := strings.TrimSpace(item.GUID)
+		if guid == "" {
+			guid = item.Link
+		}
+		if guid == "" {
+			log.Printf("skipping post %q in feed %s: no guid or link", item.Title, feed.Url)
+			continue
+		}
+
+		// Format publish date to match the variable type in params,
+		// falling back to the fetch time so one bad date doesn't lose the post
+		publishedAt, err := parsePublishDate(item.PubDate)
+		if err != nil {
+			if item.PubDate != "" {
+				log.Printf("post %q in feed %s: %v, using fetch time", item.Title, feed.Url, err)
+			}
+			publishedAt = now.UTC()
+		}
+		// Format description to match the variable type in params
+		desc := sql.NullString{
+			String: item.Description,
+			Valid:  item.Description != "",
+		}
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, "SAVEPOINT store_post")
+			if err != nil {
+				return feed, stats, err
+			}
+		}
+		// Inserts new posts and updates existing ones whose content changed upstream
+		post, err := q.CreatePost(
+			ctx,
+			database.CreatePostParams{
+				ID:          uuid.New(),
+				CreatedAt:   time.Now(),
+				UpdatedAt:   time.Now(),
+				Title:       item.Title,
+				Url:         item.Link,
+				Description: desc,
+				PublishedAt: publishedAt,
+				FeedID:      feed.ID,
+				Guid:        guid,
+			})
+		if tx != nil {
+			statements := []string{"RELEASE SAVEPOINT store_post"}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				statements = []string{"ROLLBACK TO SAVEPOINT store_post", "RELEASE SAVEPOINT store_post"}
+			}
+			for _, statement := range statements {
+				_, spErr := tx.ExecContext(ctx, statement)
+				if spErr != nil {
+					return feed, stats, spErr
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// Means the post is already stored and unchanged, simply skip
+				stats.Skipped++
+				continue
+			}
+			// For other errors, log and move on to the rest of the batch
+			log.Printf("failed to create post: %v", err)
+			failedPosts++
+			continue
+		}
+		if post.Inserted {
+			stats.New++
+		} else {
+			stats.Updated++
+		}
+	}
+
+	// Keep the feed's own idea of how often it should be polled up to date
+	hints := parseScheduleHints(result.Feed)
+	err := q.UpdateFeedScheduleHints(
+		ctx,
+		database.UpdateFeedScheduleHintsParams{
+			TtlMinutes: hints.TTLMinutes,
+			SkipHours:  hints.SkipHours,
+			SkipDays:   hints.SkipDays,
+			UpdatedAt:  now,
+			ID:         feed.ID,
+		},
+	)
+	if err != nil {
+		return feed, stats, err
+	}
+	feed.TtlMinutes = hints.TTLMinutes
+	feed.SkipHours = hints.SkipHours
+	feed.SkipDays = hints.SkipDays
+
+	// Only remember the cache headers once every post they cover is stored. Otherwise
+	// the next fetch would get a 304 and the failed posts wouldn't be retried
+	if failedPosts > 0 {
+		log.Printf("not saving cache headers for feed %s: %d posts failed to store", feed.Url, failedPosts)
+		return feed, stats, nil
+	}
+	err = q.UpdateFeedCacheHeaders(
+		ctx,
+		database.UpdateFeedCacheHeadersParams{
+			Etag:         sql.NullString{String: result.ETag, Valid: result.ETag != ""},
+			LastModified: sql.NullString{String: result.LastModified, Valid: result.LastModified != ""},
+			UpdatedAt:    now,
+			ID:           feed.ID,
+		},
+	)
+	return feed, stats, err
+}
+
+// Clears any previous failures for a feed after it was fetched successfully,
+// and schedules its next fetch from its declared hints and publishing history
+func (c *commands) recordFetchSuccess(ctx context.Context, s *state, q *database.Queries, feed database.Feed, now time.Time, result *fetchResult) error {
+	history, err := q.GetRecentPostDatesForFeed(
+		ctx,
+		database.GetRecentPostDatesForFeedParams{
+			FeedID: feed.ID,
+			Limit:  publishHistorySize,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	// Publish dates are stored in UTC while fetch times are local
+	learned := s.polling.learnInterval(history, now.UTC())
+
+	return q.RecordFeedFetchSuccess(
+		ctx,
+		database.RecordFeedFetchSuccessParams{
+			LastHttpStatus: sql.NullInt32{Int32: int32(result.StatusCode), Valid: true},
+			NextFetchAt:    nextFetchTime(feed, learned, now),
+			UpdatedAt:      now,
+			ID:             feed.ID,
+		},
+	)
+}
+
+// Stores why a fetch failed and pushes the feed's next fetch out with exponential backoff.
+// Returns the original fetch error so the caller can still report it
+func (c *commands) recordFetchFailure(ctx context.Context, s *state, feed database.Feed, now time.Time, fetchErr error) error {
+	failures := feed.ConsecutiveFailures + 1
+	retryIn := fetchBackoff(failures)
+
+	statusCode := sql.NullInt32{}
+	var statusErr *httpStatusError
+	if errors.As(fetchErr, &statusErr) {
+		statusCode = sql.NullInt32{Int32: int32(statusErr.StatusCode), Valid: true}
+		// Respect the server asking us to stay away for longer than our own backoff
+		if statusErr.RetryAfter > retryIn {
+			retryIn = statusErr.RetryAfter
+		}
+	}
+
+	err := s.db.RecordFeedFetchFailure(
+		ctx,
+		database.RecordFeedFetchFailureParams{
+			LastError:      sql.NullString{String: fetchErr.Error(), Valid: true},
+			LastHttpStatus: statusCode,
+			NextFetchAt:    sql.NullTime{Time: now.Add(retryIn), Valid: true},
+			UpdatedAt:      now,
+			ID:             feed.ID,
+		},
+	)
+	if err != nil {
+		log.Printf("failed to record fetch failure for %s: %v", feed.Url, err)
+	}
+
+	return fetchErr
+}
+
+// Returns how long to wait before retrying a feed that failed the given number of times in a row,
+// doubling from minFetchBackoff up to maxFetchBackoff
+func fetchBackoff(failures int32) time.Duration {
+	backoff := minFetchBackoff
+	for i := int32(1); i < failures; i++ {
+		backoff *= 2
+		if backoff >= maxFetchBackoff {
+			return maxFetchBackoff
+		}
+	}
+	return backoff
+}
@@ -45,7 +45,15 @@ WHERE feeds.url = $1;
 SELECT 
     *, 
     feeds.name AS feed_name,
-    users.name AS user_name
+    users.name AS user_name,
+    (
+        SELECT count(*) FROM posts
+        WHERE posts.feed_id = feeds.id
+            AND NOT EXISTS (
+                SELECT 1 FROM post_reads
+                WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+            )
+    ) AS unread_count
 FROM feed_follows
 INNER JOIN users ON users.id = feed_follows.user_id
 INNER JOIN feeds ON feeds.id = feed_follows.feed_id
@@ -60,8 +68,63 @@ UPDATE feeds
 SET last_fetched_at = $1, updated_at = $2
 WHERE id = $3;
 
--- name: GetNextFeedToFetch :one
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $1, last_modified = $2, updated_at = $3
+WHERE id = $4;
+
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET last_fetched_at = @last_fetched_at, updated_at = @updated_at, next_fetch_at = @lease_until
+WHERE id IN (
+    SELECT id
+    FROM feeds
+    WHERE next_fetch_at IS NULL OR next_fetch_at <= @due_at
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT @claim_limit
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordFeedFetchSuccess :exec
+UPDATE feeds
+SET last_error = NULL, last_http_status = $1, consecutive_failures = 0, next_fetch_at = $2, updated_at = $3
+WHERE id = $4;
+
+-- name: RecordFeedFetchFailure :exec
+UPDATE feeds
+SET last_error = $1, last_http_status = $2, consecutive_failures = consecutive_failures + 1, next_fetch_at = $3, updated_at = $4
+WHERE id = $5;
+
+-- name: GetFailingFeeds :many
+SELECT *
+FROM feeds
+WHERE consecutive_failures > 0
+ORDER BY consecutive_failures DESC, name;
+
+-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: UpdateFeedScheduleHints :exec
+UPDATE feeds
+SET ttl_minutes = $1, skip_hours = $2, skip_days = $3, updated_at = $4
+WHERE id = $5;
+
+-- name: GetFeedsByName :many
 SELECT *
 FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+WHERE feeds.name = $1;
+
+-- name: FollowFeedInCategory :execrows
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category)
+VALUES (
+$1,
+$2,
+$3,
+$4,
+$5,
+$6
+)
+ON CONFLICT (user_id, feed_id) DO NOTHING;
\ No newline at end of file
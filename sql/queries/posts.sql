@@ -1,5 +1,5 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid)
 VALUES (
 $1,
 $2,
@@ -8,15 +8,111 @@ $4,
 $5,
 $6,
 $7,
-$8
+$8,
+$9
 )
-RETURNING *;
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+    OR posts.url IS DISTINCT FROM EXCLUDED.url
+    OR posts.description IS DISTINCT FROM EXCLUDED.description
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, (xmax = 0) AS inserted;
 
--- name: GetPostsForUser :many
-SELECT posts.*
+-- name: GetRecentPostDatesForFeed :many
+SELECT published_at
+FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
+LIMIT $2;
+
+-- name: GetPost :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, guid FROM posts
+WHERE id = $1;
+
+-- name: GetPostsByURLForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1 AND posts.url = $2
+ORDER BY posts.published_at DESC;
+
+-- name: MarkPostRead :exec
+INSERT INTO post_reads (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, @read_at::timestamp
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+    AND posts.published_at < @before::timestamp
+    AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id'))
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: GetStarredPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
+FROM posts
+JOIN post_stars ON post_stars.post_id = posts.id
+WHERE post_stars.user_id = $1
+ORDER BY post_stars.starred_at DESC
+LIMIT $2;
+
+-- name: StarPost :exec
+INSERT INTO post_stars (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :execrows
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: SearchPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, ts_rank(posts.search, query)::real AS rank, feeds.name AS feed_name
 FROM posts
 JOIN feeds ON posts.feed_id = feeds.id
 JOIN feed_follows ON feeds.id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+CROSS JOIN websearch_to_tsquery('english', @query) AS query
+WHERE feed_follows.user_id = @user_id
+    AND posts.search @@ query
+    AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR posts.published_at >= sqlc.narg('since'))
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT @result_limit;
+
+-- name: BrowsePostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid
+FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+    AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR posts.published_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamp IS NULL OR posts.published_at < sqlc.narg('until'))
+    AND (NOT @unread_only::bool OR NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+    ))
+    AND (NOT @starred_only::bool OR EXISTS (
+        SELECT 1 FROM post_stars
+        WHERE post_stars.post_id = posts.id AND post_stars.user_id = feed_follows.user_id
+    ))
+    AND (
+        sqlc.narg('after_published_at')::timestamp IS NULL
+        OR (@oldest_first::bool AND (posts.published_at, posts.id) > (sqlc.narg('after_published_at'), sqlc.narg('after_id')::uuid))
+        OR (NOT @oldest_first::bool AND (posts.published_at, posts.id) < (sqlc.narg('after_published_at'), sqlc.narg('after_id')::uuid))
+    )
+ORDER BY
+    CASE WHEN @oldest_first::bool THEN posts.published_at END ASC,
+    CASE WHEN @oldest_first::bool THEN posts.id END ASC,
+    posts.published_at DESC,
+    posts.id DESC
+LIMIT @result_limit
+OFFSET @result_offset;
\ No newline at end of file
@@ -19,4 +19,4 @@ DELETE FROM users;
 
 -- name: GetUsers :many
 
-SELECT name FROM users;
\ No newline at end of file
+SELECT * FROM users;
\ No newline at end of file
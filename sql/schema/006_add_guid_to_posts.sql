@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN guid text;
+
+-- Existing posts were identified by their url
+UPDATE posts SET guid = url;
+
+ALTER TABLE posts
+ALTER COLUMN guid SET NOT NULL,
+DROP CONSTRAINT posts_url_key,
+ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+-- Drop posts sharing a url so the old unique constraint can be restored
+DELETE FROM posts a
+USING posts b
+WHERE a.url = b.url AND a.id > b.id;
+
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_guid_key,
+ADD CONSTRAINT posts_url_key UNIQUE (url),
+DROP COLUMN guid;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN last_error text NULL,
+ADD COLUMN last_http_status integer NULL,
+ADD COLUMN consecutive_failures integer NOT NULL DEFAULT 0,
+ADD COLUMN next_fetch_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_error,
+DROP COLUMN last_http_status,
+DROP COLUMN consecutive_failures,
+DROP COLUMN next_fetch_at;
\ No newline at end of file
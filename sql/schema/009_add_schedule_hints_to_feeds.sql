@@ -0,0 +1,13 @@
+-- +goose Up
+-- Scheduling hints declared by the feed itself. sy:updatePeriod/updateFrequency
+-- are converted to the equivalent ttl when stored
+ALTER TABLE feeds
+ADD COLUMN ttl_minutes integer NULL,
+ADD COLUMN skip_hours integer[] NOT NULL DEFAULT '{}',
+ADD COLUMN skip_days text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN ttl_minutes,
+DROP COLUMN skip_hours,
+DROP COLUMN skip_days;
\ No newline at end of file